@@ -32,26 +32,46 @@ func init() {
 	log.SetPrefix("")
 }
 
+// an operation is a compiled command line argument, applied to each object
+// read from input.
+type operation func(out io.Writer, obj interface{}) (interface{}, error)
+
+// a flush finishes up an output that holds on to objects until all of the
+// input has been read.
+type flush func(out io.Writer) error
+
 func apply(in io.Reader, out io.Writer, args []string) error {
-	dec := json.NewDecoder(in)
+	ops, flushes, err := compileArgs(args)
+	if err != nil {
+		return err
+	}
+
+	dec := newDecoder(in, args)
 
 	for {
 		var obj interface{}
 		if err := dec.Decode(&obj); err != nil {
 			if err == io.EOF {
+				for _, fl := range flushes {
+					if err := fl(out); err != nil {
+						return err
+					}
+				}
 				return nil
 			}
 			return fmt.Errorf("error reading stdin: %v", err)
 		}
 
-		for i, arg := range args {
+		for i, op := range ops {
 			var err error
-			obj, err = ft(out, obj, arg)
-			if _, isReplaceError := err.(replaceError); isReplaceError || err == errUnrecognizedOp || err == errIllegalOp {
-				return fmt.Errorf("error with %q: %v", arg, err)
+			obj, err = op(out, obj)
+			if _, isReplaceError := err.(replaceError); isReplaceError || err == errIllegalOp {
+				return fmt.Errorf("error with %q: %v", args[i], err)
 			}
 			if err != nil {
-				continue
+				// the object did not make it through, so nothing more to do
+				obj = nil
+				break
 			}
 
 			if obj == nil {
@@ -72,7 +92,6 @@ func apply(in io.Reader, out io.Writer, args []string) error {
 			fmt.Fprintf(out, "%s\n", b)
 		}
 	}
-	return nil
 }
 
 func main() {
@@ -81,113 +100,215 @@ func main() {
 	}
 }
 
-func ft(out io.Writer, obj interface{}, arg string) (interface{}, error) {
+// compileArgs compiles every argument, so that a mistake in any of them is
+// reported before any input is read.
+func compileArgs(args []string) ([]operation, []flush, error) {
+	ops := make([]operation, len(args))
+	var flushes []flush
+	for i, arg := range args {
+		op, fl, err := compile(arg)
+		if serr, ok := err.(*syntaxError); ok {
+			serr.arg, serr.argn = arg, i+1
+			return nil, nil, serr
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error with %q: %v", arg, err)
+		}
+		ops[i] = op
+		if fl != nil {
+			flushes = append(flushes, fl)
+		}
+	}
+	return ops, flushes, nil
+}
+
+func compile(arg string) (operation, flush, error) {
 	switch {
 	case strings.HasPrefix(arg, "f:"):
-		return filter(obj, obj, strings.TrimPrefix(arg, "f:"))
+		f, err := compileFilter(strings.TrimPrefix(arg, "f:"))
+		if err != nil {
+			return nil, nil, shift(err, "f:")
+		}
+		return func(out io.Writer, obj interface{}) (interface{}, error) {
+			return filter(obj, obj, f)
+		}, nil, nil
 	case strings.HasPrefix(arg, "t:"):
-		return transform(obj, strings.TrimPrefix(arg, "t:"))
+		t, err := compileTransform(strings.TrimPrefix(arg, "t:"))
+		if err != nil {
+			return nil, nil, shift(err, "t:")
+		}
+		return func(out io.Writer, obj interface{}) (interface{}, error) {
+			return transform(obj, t)
+		}, nil, nil
 	case strings.HasPrefix(arg, "o:"):
-		return nil, output(out, obj, strings.TrimPrefix(arg, "o:"))
+		op, fl, err := compileOutput(strings.TrimPrefix(arg, "o:"))
+		if err != nil {
+			return nil, nil, shift(err, "o:")
+		}
+		return op, fl, nil
+	case strings.HasPrefix(arg, "i:"):
+		op, err := compileInput(strings.TrimPrefix(arg, "i:"))
+		if err != nil {
+			return nil, nil, shift(err, "i:")
+		}
+		return op, nil, nil
 	case strings.HasPrefix(arg, "#"):
 		// this is a comment, skip
-		return obj, nil
+		return func(out io.Writer, obj interface{}) (interface{}, error) {
+			return obj, nil
+		}, nil, nil
 	default:
-		return nil, errUnrecognizedOp
+		return nil, nil, &syntaxError{msg: "expected 'f:', 't:', 'o:', 'i:' or '#'"}
 	}
 }
 
-func filter(obj, root interface{}, farg string) (interface{}, error) {
-	if farg == "" {
-		return nil, errUnrecognizedOp
-	}
-
-	if strings.HasPrefix(farg, "=.") {
-		return filterLookupValue(obj, root, farg)
-	}
-	if strings.HasPrefix(farg, "=[") {
-		return filterLookupValue(obj, root, farg)
-	}
-	if strings.HasPrefix(farg, "=") {
-		return filterExactValue(obj, root, farg)
-	}
-
-	if strings.HasPrefix(farg, "[]") {
-		return filterListExcludeMiss(obj, root, farg)
-	}
-	if strings.HasPrefix(farg, "[E]") {
-		return filterListAtLeastOne(obj, root, farg)
-	}
-
-	if strings.HasPrefix(farg, ".()") {
-		return filterFieldsExcludeMiss(obj, root, farg)
-	}
-	if strings.HasPrefix(farg, ".(E)") {
-		return filterFieldsAtLeastOne(obj, root, farg)
-	}
-
-	if index, ok := matchExactIndex(farg); ok {
-		return filterExplicitIndex(obj, root, farg, index)
-	}
-	if field, ok := matchExactField(farg); ok {
-		return filterExplicitField(obj, root, farg, field)
-	}
-
-	if filters, ok := matchMulti(farg); ok {
-		return filterMulti(obj, root, farg, filters)
+func filter(obj, root interface{}, f []step) (interface{}, error) {
+	if len(f) == 0 {
+		return obj, nil
 	}
 
-	if includes, ok := matchCut(farg); ok {
-		return filterCut(obj, root, farg, includes)
+	switch s := f[0].(type) {
+	case lookupValue:
+		return filterLookupValue(obj, root, s)
+	case exactValue:
+		return filterExactValue(obj, root, s)
+	case typeTest:
+		return filterTypeTest(obj, s)
+
+	case allIndices:
+		return filterListExcludeMiss(obj, root, f[1:])
+	case someIndex:
+		return filterListAtLeastOne(obj, root, f[1:])
+	case everyIndex:
+		return filterListAll(obj, root, f[1:])
+
+	case allFields:
+		return filterFieldsExcludeMiss(obj, root, f[1:])
+	case someField:
+		return filterFieldsAtLeastOne(obj, root, f[1:])
+	case everyField:
+		return filterFieldsAll(obj, root, f[1:])
+	case fieldPattern:
+		return filterFieldPattern(obj, root, f[1:], s.re)
+
+	case recursive:
+		return filterRecursive(obj, root, f[1:])
+	case anyKept:
+		return filterAnyKept(obj, root, f[1:], s.s)
+
+	case explicitIndex:
+		return filterExplicitIndex(obj, root, f[1:], s.index)
+	case slice:
+		return filterSlice(obj, root, f[1:], s)
+	case explicitField:
+		return filterExplicitField(obj, root, f[1:], s.field)
+
+	case multi:
+		return filterMulti(obj, root, s.filters)
+
+	case call:
+		return filterCall(obj, root, f[1:], s)
+
+	case negation:
+		return filterNegation(obj, root, f[1:])
+	case alternation:
+		return filterAlternation(obj, root, s.filters)
+
+	case cut:
+		return filterCut(obj, root, s.includes, s.indices, s.patterns)
 	}
 
 	return obj, errUnrecognizedOp
 }
 
-func transform(obj interface{}, targ string) (interface{}, error) {
-	// log.Printf("transform %q", targ)
+func transform(obj interface{}, t []step) (interface{}, error) {
+	// log.Printf("transform %v", t)
 
-	if targ == "" {
+	if len(t) == 0 {
 		return nil, errUnrecognizedOp
 	}
 
-	if strings.HasPrefix(targ, "[]") {
-		return transformAllIndices(obj, targ)
-	}
-	if strings.HasPrefix(targ, ".()") {
-		return transformAllFields(obj, targ)
-	}
+	switch s := t[0].(type) {
+	case allIndices:
+		return transformAllIndices(obj, t[1:])
+	case allFields:
+		return transformAllFields(obj, t[1:])
+	case fieldPattern:
+		return transformFieldPattern(obj, t[1:], s.re)
 
-	if index, ok := matchExactIndex(targ); ok {
-		return transformExplicitIndex(obj, targ, index)
-	}
-	if field, ok := matchExactField(targ); ok {
-		return transformExplicitField(obj, targ, field)
-	}
+	case explicitIndex:
+		return transformExplicitIndex(obj, t[1:], s.index)
+	case slice:
+		return transformSlice(obj, t[1:], s)
+	case explicitField:
+		return transformExplicitField(obj, t[1:], s.field)
 
-	if to, from, ok := matchReplace(targ); ok {
-		return replace(obj, to, from)
+	case replacement:
+		return replace(obj, s.op, s.to, s.from)
+	case deletion:
+		return deleteValue(obj, s.at)
 	}
 
 	return nil, errUnrecognizedOp
 }
 
-func output(out io.Writer, obj interface{}, oarg string) error {
+func compileOutput(oarg string) (operation, flush, error) {
+	var tmpl *template.Template
+	var err error
 	switch {
+	case oarg == "yaml":
+		return outputYAML(), nil, nil
+	case strings.HasPrefix(oarg, "csv="):
+		op, err := outputCSV(oarg, "csv=", ',')
+		return op, nil, err
+	case strings.HasPrefix(oarg, "tsv="):
+		op, err := outputCSV(oarg, "tsv=", '\t')
+		return op, nil, err
+	case strings.HasPrefix(oarg, "table="):
+		return outputTable(oarg, "table=")
 	case strings.HasPrefix(oarg, "templatefile="):
-		return printTemplateFile(out, obj, strings.TrimPrefix(oarg, "templatefile="))
+		tmpl, err = template.ParseFiles(strings.TrimPrefix(oarg, "templatefile="))
 	case strings.HasPrefix(oarg, "template="):
-		return printTemplate(out, obj, strings.TrimPrefix(oarg, "template="))
+		tmpl, err = template.New("dft").Parse(strings.TrimPrefix(oarg, "template="))
 	default:
-		return errUnrecognizedOp
+		return nil, nil, &syntaxError{msg: "expected 'yaml', 'csv=', 'tsv=', 'table=', 'template=' or 'templatefile='"}
+	}
+	if err != nil {
+		return nil, nil, err
 	}
+	return func(out io.Writer, obj interface{}) (interface{}, error) {
+		return nil, tmpl.Execute(out, obj)
+	}, nil, nil
 }
 
-func replace(obj interface{}, to, from string) (interface{}, error) {
-	// log.Printf("replace %q %q", from, to)
+func replace(obj interface{}, op string, to, from path) (interface{}, error) {
+	// log.Printf("replace %v %s %v", to, op, from)
+	if op == "?=" {
+		if _, err := getValue(obj, to); err == nil {
+			// it's already there, so leave it be
+			return obj, nil
+		}
+	}
+
 	v, err := getValue(obj, from)
+	if op == "?=" && (err == errNotFound || err == errNotList || err == errNotStruct) {
+		// there's nothing to fill in with, so leave the destination missing
+		return obj, nil
+	}
 	if err != nil {
-		return nil, replaceError(err.Error())
+		return nil, replaceError(sourceError(from, err))
+	}
+	if op != "<-" {
+		// a copy shouldn't change when what it was copied from does
+		v = copyValue(v)
+	}
+
+	if op == "<-" {
+		// deleting and setting both change obj, so work on a copy in case
+		// the set fails after the delete
+		if obj, err = deleteValue(copyValue(obj), from); err != nil {
+			return nil, replaceError(fmt.Sprintf("could not move %q: %v", from, err))
+		}
 	}
 
 	r, err := setValue(obj, to, v)
@@ -198,51 +319,83 @@ func replace(obj interface{}, to, from string) (interface{}, error) {
 	return r, nil
 }
 
-func getValue(obj interface{}, from string) (interface{}, error) {
-	// log.Printf("gv %q", from)
-	if from == "" {
-		return obj, nil
-	}
-	if index, ok := matchExactIndex(from); ok {
-		return getExplicitIndex(obj, from, index)
-	}
-	if field, ok := matchExactField(from); ok {
-		return getExplicitField(obj, from, field)
+// sourceError says which source couldn't be found, and why.
+func sourceError(from path, err error) string {
+	switch err {
+	case errNotFound:
+		for _, st := range from {
+			// .a-1 is the field "a-1", which is an easy mistake to make
+			if s, ok := st.(explicitField); ok && strings.Contains(s.field, "-") {
+				return fmt.Sprintf("%q not found (put spaces around '-' to subtract)", from)
+			}
+		}
+		return fmt.Sprintf("%q not found", from)
+	case errNotList, errNotStruct:
+		return fmt.Sprintf("cannot find %q: %v", from, err)
 	}
-
-	return nil, fmt.Errorf("cannot use %q as source", from)
+	return err.Error()
 }
 
-func setValue(obj interface{}, to string, v interface{}) (interface{}, error) {
-	// log.Printf("sv %q %v", to, v)
-	if to == "" {
-		return v, nil
+func getValue(obj interface{}, from path) (interface{}, error) {
+	// log.Printf("gv %v", from)
+	if len(from) == 0 {
+		return obj, nil
 	}
 
-	if index, ok := matchExactIndex(to); ok {
-		return setExplicitIndex(obj, to, v, index)
-	}
-	if field, ok := matchExactField(to); ok {
-		return setExplicitField(obj, to, v, field)
+	switch s := from[0].(type) {
+	case literal:
+		return getValue(copyValue(s.value), from[1:])
+	case binary:
+		return getBinary(obj, from[1:], s)
+	case call:
+		return getCall(obj, from[1:], s)
+	case regexpArg:
+		return s.re, nil
+	case recursive:
+		return getRecursive(obj, from[1:])
+	case explicitIndex:
+		return getExplicitIndex(obj, from[1:], s.index)
+	case slice:
+		return getSlice(obj, from[1:], s)
+	case explicitField:
+		return getExplicitField(obj, from[1:], s.field)
 	}
 
 	return nil, errIllegalOp
 }
 
-func printTemplateFile(out io.Writer, obj interface{}, filename string) error {
-	tmpl, err := template.ParseFiles(filename)
-	if err != nil {
-		return err
+func setValue(obj interface{}, to path, v interface{}) (interface{}, error) {
+	// log.Printf("sv %v %v", to, v)
+	if len(to) == 0 {
+		return v, nil
+	}
+
+	switch s := to[0].(type) {
+	case explicitIndex:
+		return setExplicitIndex(obj, to[1:], v, s.index)
+	case explicitField:
+		return setExplicitField(obj, to[1:], v, s.field)
 	}
 
-	return tmpl.Execute(out, obj)
+	return nil, errIllegalOp
 }
 
-func printTemplate(out io.Writer, obj interface{}, format string) error {
-	tmpl, err := template.New("dft").Parse(format)
-	if err != nil {
-		return err
+// deleteValue removes whatever is at the path. Anything that isn't there is
+// already deleted, so that isn't an error.
+func deleteValue(obj interface{}, at path) (interface{}, error) {
+	// log.Printf("dv %v", at)
+	switch s := at[0].(type) {
+	case explicitIndex:
+		return deleteExplicitIndex(obj, at[1:], s.index)
+	case explicitField:
+		return deleteExplicitField(obj, at[1:], s.field)
+	case slice:
+		return deleteSlice(obj, at[1:], s)
+	case allIndices:
+		return deleteSlice(obj, at[1:], slice{stride: 1})
+	case allFields:
+		return deleteAllFields(obj, at[1:])
 	}
 
-	return tmpl.Execute(out, obj)
+	return nil, errIllegalOp
 }
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type function struct {
+	minArgs, maxArgs int
+	// fn is given the values of the arguments, already evaluated.
+	fn func(args []interface{}) (interface{}, error)
+}
+
+// functions are what can be called in a source, like lower(.name).
+var functions = map[string]function{
+	"upper": {1, 1, func(args []interface{}) (interface{}, error) {
+		s, err := stringArg(args, 0)
+		return strings.ToUpper(s), err
+	}},
+	"lower": {1, 1, func(args []interface{}) (interface{}, error) {
+		s, err := stringArg(args, 0)
+		return strings.ToLower(s), err
+	}},
+	"trim": {1, 2, callTrim},
+	"split": {2, 2, func(args []interface{}) (interface{}, error) {
+		s, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		sep, err := stringArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		r := []interface{}{}
+		for _, part := range strings.Split(s, sep) {
+			r = append(r, part)
+		}
+		return r, nil
+	}},
+	"join":    {2, 2, callJoin},
+	"replace": {3, 3, callReplace},
+	"substr":  {2, 3, callSubstr},
+	"first": {1, 1, func(args []interface{}) (interface{}, error) {
+		l, err := listArg(args, 0)
+		if err != nil || len(l) == 0 {
+			return nil, err
+		}
+		return l[0], nil
+	}},
+	"last": {1, 1, func(args []interface{}) (interface{}, error) {
+		l, err := listArg(args, 0)
+		if err != nil || len(l) == 0 {
+			return nil, err
+		}
+		return l[len(l)-1], nil
+	}},
+	"match": {2, 3, callMatch},
+	"sub":   {3, 3, callSub},
+
+	"len": {1, 1, callLen},
+
+	"tonumber": {1, 1, callToNumber},
+	"tostring": {1, 1, callToString},
+	"tobool":   {1, 1, callToBool},
+	"type": {1, 1, func(args []interface{}) (interface{}, error) {
+		return typeName(args[0]), nil
+	}},
+}
+
+func (fn function) arity() string {
+	switch {
+	case fn.minArgs == fn.maxArgs && fn.minArgs == 1:
+		return "1 argument"
+	case fn.minArgs == fn.maxArgs:
+		return fmt.Sprintf("%d arguments", fn.minArgs)
+	}
+	return fmt.Sprintf("%d to %d arguments", fn.minArgs, fn.maxArgs)
+}
+
+// getCall calls a function with the values of its arguments, and then
+// carries on with rfrom from the result.
+func getCall(obj interface{}, rfrom path, c call) (interface{}, error) {
+	args := make([]interface{}, len(c.args))
+	for i, arg := range c.args {
+		v, err := getValue(obj, arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := functions[c.name].fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compute %q: %v", c, err)
+	}
+	return getValue(v, rfrom)
+}
+
+func (c call) String() string {
+	args := make([]string, len(c.args))
+	for i, arg := range c.args {
+		args[i] = arg.String()
+	}
+	return c.name + "(" + strings.Join(args, ",") + ")"
+}
+
+func stringArg(args []interface{}, i int) (string, error) {
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("%s is not a string", jsonString(args[i]))
+	}
+	return s, nil
+}
+
+func numberArg(args []interface{}, i int) (float64, error) {
+	n, ok := args[i].(float64)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a number", jsonString(args[i]))
+	}
+	return n, nil
+}
+
+func listArg(args []interface{}, i int) ([]interface{}, error) {
+	l, ok := args[i].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not a list", jsonString(args[i]))
+	}
+	return l, nil
+}
+
+// len(<value>) counts the elements of a list, the fields of an object, or
+// the characters of a string.
+func callLen(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	}
+	return nil, fmt.Errorf("%s has no length", jsonString(args[0]))
+}
+
+// tonumber(<value>) parses strings as numbers, and turns true and false
+// into 1 and 0.
+func callToNumber(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case float64:
+		return v, nil
+	case string:
+		n, ok := jsonNumber(strings.TrimSpace(v))
+		if !ok {
+			return nil, fmt.Errorf("%s is not a number", jsonString(v))
+		}
+		return n, nil
+	case bool:
+		if v {
+			return 1.0, nil
+		}
+		return 0.0, nil
+	}
+	return nil, fmt.Errorf("%s is not a number", jsonString(args[0]))
+}
+
+// tostring(<value>) leaves strings alone, and writes anything else the way
+// it would look as json.
+func callToString(args []interface{}) (interface{}, error) {
+	if s, ok := args[0].(string); ok {
+		return s, nil
+	}
+	return jsonString(args[0]), nil
+}
+
+// tobool(<value>) parses strings like "true" and "0", treats non-zero
+// numbers as true, and null as false.
+func callToBool(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a boolean", jsonString(v))
+		}
+		return b, nil
+	case float64:
+		return v != 0, nil
+	case nil:
+		return false, nil
+	}
+	return nil, fmt.Errorf("%s is not a boolean", jsonString(args[0]))
+}
+
+// typeName names the json type of a value.
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// regexpArgument accepts a /<regexp>/ argument, or a string to compile as
+// one. Strings can come from the input, so they aren't cached the way the
+// regexps in arguments are.
+func regexpArgument(args []interface{}, i int) (*regexp.Regexp, error) {
+	switch v := args[i].(type) {
+	case *regexp.Regexp:
+		return v, nil
+	case string:
+		return regexp.Compile(v)
+	}
+	return nil, fmt.Errorf("%s is not a regular expression", jsonString(args[i]))
+}
+
+// match(<string>,<regexp>) returns the first match of regexp in string, and
+// match(<string>,<regexp>,<group>) returns that capture group instead. If
+// there is no match, it returns null.
+func callMatch(args []interface{}) (interface{}, error) {
+	s, err := stringArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexpArgument(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	group := 0
+	if len(args) == 3 {
+		n, err := numberArg(args, 2)
+		if err != nil {
+			return nil, err
+		}
+		group = int(n)
+		if group < 0 || group > re.NumSubexp() {
+			return nil, fmt.Errorf("/%s/ has no group %d", re, group)
+		}
+	}
+	m := re.FindStringSubmatch(s)
+	if m == nil {
+		return nil, nil
+	}
+	return m[group], nil
+}
+
+// sub(<string>,<regexp>,<replacement>) replaces every match of regexp, and
+// replacement can refer to capture groups with $1, $2 and so on.
+func callSub(args []interface{}) (interface{}, error) {
+	s, err := stringArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexpArgument(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	repl, err := stringArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return re.ReplaceAllString(s, repl), nil
+}
+
+// trim(<string>) trims whitespace, and trim(<string>,<cutset>) trims any of
+// the characters in cutset.
+func callTrim(args []interface{}) (interface{}, error) {
+	s, err := stringArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 1 {
+		return strings.TrimSpace(s), nil
+	}
+	cutset, err := stringArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Trim(s, cutset), nil
+}
+
+// join(<list>,<sep>) joins the elements of list, which don't have to be
+// strings.
+func callJoin(args []interface{}) (interface{}, error) {
+	l, err := listArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	sep, err := stringArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(l))
+	for i, v := range l {
+		if s, ok := v.(string); ok {
+			parts[i] = s
+		} else {
+			parts[i] = jsonString(v)
+		}
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// replace(<string>,<old>,<new>) replaces every old with new.
+func callReplace(args []interface{}) (interface{}, error) {
+	var s [3]string
+	for i := range s {
+		var err error
+		if s[i], err = stringArg(args, i); err != nil {
+			return nil, err
+		}
+	}
+	return strings.Replace(s[0], s[1], s[2], -1), nil
+}
+
+// substr(<string>,<start>) and substr(<string>,<start>,<length>) count in
+// characters rather than bytes, and a negative start counts back from the
+// end.
+func callSubstr(args []interface{}) (interface{}, error) {
+	s, err := stringArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	start, err := numberArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(s)
+	// keep start where it fits in an int before clamping it
+	start = math.Max(math.Min(start, float64(len(runes))), -float64(len(runes)))
+	begin := clampIndex(int(start), len(runes), 1)
+	end := len(runes)
+	if len(args) == 3 {
+		length, err := numberArg(args, 2)
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, fmt.Errorf("negative length %v", length)
+		}
+		// compare as floats, since a huge length won't fit in an int
+		if length < float64(end-begin) {
+			end = begin + int(length)
+		}
+	}
+	return string(runes[begin:end]), nil
+}
+
+// getBinary does arithmetic with the values of both sides, and then carries
+// on with rfrom from the result.
+func getBinary(obj interface{}, rfrom path, b binary) (interface{}, error) {
+	left, err := getValue(obj, b.left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := getValue(obj, b.right)
+	if err != nil {
+		return nil, err
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	switch {
+	case !lok:
+		return nil, fmt.Errorf("cannot compute %q: %s is not a number", b, jsonString(left))
+	case !rok:
+		return nil, fmt.Errorf("cannot compute %q: %s is not a number", b, jsonString(right))
+	}
+
+	var v float64
+	switch b.op {
+	case "+":
+		v = l + r
+	case "-":
+		v = l - r
+	case "*":
+		v = l * r
+	case "/", "%":
+		if r == 0 {
+			return nil, fmt.Errorf("cannot compute %q: division by zero", b)
+		}
+		if b.op == "/" {
+			v = l / r
+		} else {
+			v = math.Mod(l, r)
+		}
+	default:
+		return nil, errIllegalOp
+	}
+	return getValue(v, rfrom)
+}
+
+// jsonNumberRE is what a number looks like in json, with leading zeros
+// allowed. Go would also read things like nan, inf and 0x1p-2 as numbers.
+var jsonNumberRE = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// jsonNumber parses s if it is a number json can hold.
+func jsonNumber(s string) (float64, bool) {
+	if !jsonNumberRE.MatchString(s) {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	// too big a number is out of range, and comes back as Inf
+	return n, err == nil
+}
+
+// jsonString formats a value the way it would look on input, for error
+// messages.
+func jsonString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func (b binary) String() string {
+	return b.left.String() + b.op + b.right.String()
+}
@@ -1,8 +1,9 @@
 package main
 
 import (
-	"fmt"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -11,75 +12,137 @@ var (
 	regexps = map[string]*regexp.Regexp{}
 )
 
-func filterExactValue(obj, root interface{}, farg string) (interface{}, error) {
-	// log.Printf("fev: %v, %q", obj, farg)
-	vstr := farg[1:]
+func filterExactValue(obj, root interface{}, ev exactValue) (interface{}, error) {
+	// log.Printf("fev: %v, %v", obj, ev)
+	var matched bool
+	switch ev.op {
+	case "=":
+		matched = equalsExactValue(obj, ev)
+	case "!=":
+		matched = !equalsExactValue(obj, ev)
+	default:
+		c, ok := compareExactValue(obj, ev)
+		matched = ok && ordered(ev.op, c)
+	}
+	if matched {
+		return obj, nil
+	}
+	return nil, errNotMatched
+}
 
+func equalsExactValue(obj interface{}, ev exactValue) bool {
 	switch v := obj.(type) {
-	case int:
-		if fv, err := strconv.ParseInt(vstr, 10, 64); err == nil && int(fv) == v {
-			return obj, nil
-		}
 	case float64:
-		if fv, err := strconv.ParseFloat(vstr, 10); err == nil && float64(fv) == v {
-			return obj, nil
-		}
+		return ev.isNum && ev.num == v
 	case string:
-		// quoted raw string comparison, to allow strings to begin with
-		// one of the special prefixes: . [ /
-		if strings.HasPrefix(vstr, `"`) && strings.HasSuffix(vstr, `"`) {
-			vstr = vstr[1 : len(vstr)-1]
-			if vstr == v {
-				return obj, nil
-			}
-			return nil, errNotMatched
+		if ev.quoted {
+			return ev.vstr == v
 		}
 		// regular expression
-		if strings.HasPrefix(vstr, `/`) && strings.HasSuffix(vstr, `/`) {
-			vstr = vstr[1 : len(vstr)-1]
-			if _, ok := regexps[vstr]; !ok {
-				re, err := regexp.Compile(vstr)
-				if err != nil {
-					return nil, err
-				}
-				regexps[vstr] = re
-			}
-			re := regexps[vstr]
-			if re.MatchString(v) {
-				return obj, nil
-			}
+		if ev.re != nil && ev.re.MatchString(v) {
+			return true
 		}
 		// default to raw string comparison
-		if vstr == v {
-			return obj, nil
+		return ev.vstr == v
+	case bool:
+		return !ev.quoted && ev.vstr == strconv.FormatBool(v)
+	case nil:
+		return !ev.quoted && ev.vstr == "null"
+	}
+	return false
+}
+
+// compareExactValue compares numbers numerically and strings
+// lexicographically, returning false if obj can't be compared with ev. A
+// bare number is never compared with a string; quote it to compare it as one.
+func compareExactValue(obj interface{}, ev exactValue) (int, bool) {
+	switch v := obj.(type) {
+	case float64:
+		if ev.isNum {
+			return compareValues(v, ev.num)
 		}
-		return nil, errNotMatched
+	case string:
+		if !ev.isNum {
+			return compareValues(v, ev.vstr)
+		}
+	}
+	return 0, false
+}
 
+func compareValues(a, b interface{}) (int, bool) {
+	switch av := a.(type) {
+	case float64:
+		if bv, ok := b.(float64); ok {
+			switch {
+			case av < bv:
+				return -1, true
+			case av > bv:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), true
+		}
 	}
-	return nil, errNotMatched
+	return 0, false
 }
 
-func filterLookupValue(obj, root interface{}, farg string) (interface{}, error) {
-	rfarg := strings.TrimPrefix(farg, "=")
+// ordered reports whether the result of a comparison satisfies op.
+func ordered(op string, c int) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
 
-	v, err := getValue(root, rfarg)
+func filterLookupValue(obj, root interface{}, lv lookupValue) (interface{}, error) {
+	v, err := getValue(root, lv.from)
 	if err != nil {
 		return nil, err
 	}
 
-	if v == obj {
+	var matched bool
+	switch lv.op {
+	case "=":
+		matched = reflect.DeepEqual(obj, v)
+	case "!=":
+		matched = !reflect.DeepEqual(obj, v)
+	default:
+		c, ok := compareValues(obj, v)
+		matched = ok && ordered(lv.op, c)
+	}
+	if matched {
 		return obj, nil
 	}
 	return nil, errNotMatched
 }
 
-func filterListExcludeMiss(obj, root interface{}, farg string) (interface{}, error) {
-	// log.Printf("flem: %v, %q", obj, farg)
-	rfarg := strings.TrimPrefix(farg, "[]")
+func filterTypeTest(obj interface{}, tt typeTest) (interface{}, error) {
+	if typeName(obj) != tt.name {
+		return nil, errNotMatched
+	}
+	return obj, nil
+}
+
+func filterListExcludeMiss(obj, root interface{}, rf []step) (interface{}, error) {
+	// log.Printf("flem: %v, %v", obj, rf)
 	if v, ok := obj.([]interface{}); ok {
 		r := make([]interface{}, 0, 0)
 		for _, subobj := range v {
-			rsubobj, err := filter(subobj, root, rfarg)
+			rsubobj, err := filter(subobj, root, rf)
 			if err == nil {
 				r = append(r, rsubobj)
 			}
@@ -89,11 +152,10 @@ func filterListExcludeMiss(obj, root interface{}, farg string) (interface{}, err
 	return nil, errNotList
 }
 
-func filterListAtLeastOne(obj, root interface{}, farg string) (interface{}, error) {
-	rfarg := strings.TrimPrefix(farg, "[E]")
+func filterListAtLeastOne(obj, root interface{}, rf []step) (interface{}, error) {
 	if v, ok := obj.([]interface{}); ok {
 		for _, subobj := range v {
-			if _, err := filter(subobj, root, rfarg); err == nil {
+			if _, err := filter(subobj, root, rf); err == nil {
 				return obj, nil
 			}
 		}
@@ -102,12 +164,23 @@ func filterListAtLeastOne(obj, root interface{}, farg string) (interface{}, erro
 	return nil, errNotList
 }
 
-func filterFieldsExcludeMiss(obj, root interface{}, farg string) (interface{}, error) {
-	rfarg := strings.TrimPrefix(farg, ".()")
+func filterListAll(obj, root interface{}, rf []step) (interface{}, error) {
+	if v, ok := obj.([]interface{}); ok {
+		for _, subobj := range v {
+			if _, err := filter(subobj, root, rf); err != nil {
+				return nil, errNotMatched
+			}
+		}
+		return obj, nil
+	}
+	return nil, errNotList
+}
+
+func filterFieldsExcludeMiss(obj, root interface{}, rf []step) (interface{}, error) {
 	if v, ok := obj.(map[string]interface{}); ok {
 		r := map[string]interface{}{}
 		for key, subobj := range v {
-			rsubobj, err := filter(subobj, root, rfarg)
+			rsubobj, err := filter(subobj, root, rf)
 			if err == nil {
 				r[key] = rsubobj
 			}
@@ -117,11 +190,10 @@ func filterFieldsExcludeMiss(obj, root interface{}, farg string) (interface{}, e
 	return nil, errNotStruct
 }
 
-func filterFieldsAtLeastOne(obj, root interface{}, farg string) (interface{}, error) {
-	rfarg := strings.TrimPrefix(farg, ".(E)")
+func filterFieldsAtLeastOne(obj, root interface{}, rf []step) (interface{}, error) {
 	if v, ok := obj.(map[string]interface{}); ok {
 		for _, subobj := range v {
-			if _, err := filter(subobj, root, rfarg); err == nil {
+			if _, err := filter(subobj, root, rf); err == nil {
 				return obj, nil
 			}
 		}
@@ -130,28 +202,134 @@ func filterFieldsAtLeastOne(obj, root interface{}, farg string) (interface{}, er
 	return nil, errNotStruct
 }
 
-func filterExplicitIndex(obj, root interface{}, farg, index string) (interface{}, error) {
-	// log.Printf("ei: %v, %q, %s", obj, farg, index)
-	idx, err := strconv.ParseInt(index, 10, 64)
+func filterFieldsAll(obj, root interface{}, rf []step) (interface{}, error) {
+	if v, ok := obj.(map[string]interface{}); ok {
+		for _, subobj := range v {
+			if _, err := filter(subobj, root, rf); err != nil {
+				return nil, errNotMatched
+			}
+		}
+		return obj, nil
+	}
+	return nil, errNotStruct
+}
+
+func filterRecursive(obj, root interface{}, rf []step) (interface{}, error) {
+	matched := false
+	descend(obj, func(subobj interface{}) bool {
+		if !hasField(subobj, rf) {
+			return true
+		}
+		// filters trim what they pass, but a search passes obj as it was
+		_, err := filter(copyValue(subobj), root, rf)
+		matched = err == nil
+		return !matched
+	})
+	if matched {
+		return obj, nil
+	}
+	return nil, errNotMatched
+}
+
+func filterAnyKept(obj, root interface{}, rf []step, s step) (interface{}, error) {
+	r, err := filter(obj, root, append([]step{s}, rf...))
 	if err != nil {
-		panic(fmt.Sprintf("somehow got bad strconv.ParseInt(%q): %v", index, err))
+		return nil, err
 	}
-	rfarg := strings.TrimPrefix(farg, fmt.Sprintf("[%s]", index))
+	switch v := r.(type) {
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, errNotMatched
+		}
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return nil, errNotMatched
+		}
+	}
+	return r, nil
+}
 
+// hasField reports whether obj has the field that f starts with, if it
+// starts with one. A filter on a field passes anything that isn't a
+// structure, but when searching at any depth that shouldn't count as a match.
+func hasField(obj interface{}, f []step) bool {
+	if len(f) == 0 {
+		return true
+	}
+	s, ok := f[0].(explicitField)
+	if !ok {
+		return true
+	}
+	v, ok := obj.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = v[s.field]
+	return ok
+}
+
+// descend calls visit with obj and then everything nested inside of it,
+// depth first and in field name order, until visit returns false. It
+// returns false if it was stopped early.
+func descend(obj interface{}, visit func(interface{}) bool) bool {
+	if !visit(obj) {
+		return false
+	}
+	switch v := obj.(type) {
+	case []interface{}:
+		for _, subobj := range v {
+			if !descend(subobj, visit) {
+				return false
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !descend(v[key], visit) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func filterFieldPattern(obj, root interface{}, rf []step, re *regexp.Regexp) (interface{}, error) {
+	if v, ok := obj.(map[string]interface{}); ok {
+		r := map[string]interface{}{}
+		for key, subobj := range v {
+			if !re.MatchString(key) {
+				continue
+			}
+			rsubobj, err := filter(subobj, root, rf)
+			if err == nil {
+				r[key] = rsubobj
+			}
+		}
+		return r, nil
+	}
+	return nil, errNotStruct
+}
+
+func filterExplicitIndex(obj, root interface{}, rf []step, idx int) (interface{}, error) {
+	// log.Printf("ei: %v, %v, %d", obj, rf, idx)
 	v, ok := obj.([]interface{})
 	if !ok {
 		return nil, errNotList
 	}
 
-	if rfarg == "" {
-		if int(idx) < len(v) {
-			return v, nil
-		} else {
-			return nil, errNotFound
-		}
+	idx, ok = resolveIndex(idx, len(v))
+	if !ok {
+		return nil, errNotFound
+	}
+	if len(rf) == 0 {
+		return v, nil
 	}
 
-	subobj, err := filter(v[idx], root, rfarg)
+	subobj, err := filter(v[idx], root, rf)
 	if err != nil {
 		return nil, err
 	}
@@ -159,24 +337,36 @@ func filterExplicitIndex(obj, root interface{}, farg, index string) (interface{}
 	return v, nil
 }
 
-func filterExplicitField(obj, root interface{}, farg, field string) (interface{}, error) {
-	// log.Printf("ef: %v, %q, %s", obj, farg, field)
-	rfarg := strings.TrimPrefix(farg, fmt.Sprintf(".%s", field))
+func filterSlice(obj, root interface{}, rf []step, s slice) (interface{}, error) {
+	if v, ok := obj.([]interface{}); ok {
+		r := make([]interface{}, 0, 0)
+		for _, idx := range s.indices(len(v)) {
+			rsubobj, err := filter(v[idx], root, rf)
+			if err == nil {
+				r = append(r, rsubobj)
+			}
+		}
+		return r, nil
+	}
+	return nil, errNotList
+}
 
+func filterExplicitField(obj, root interface{}, rf []step, field string) (interface{}, error) {
+	// log.Printf("ef: %v, %v, %s", obj, rf, field)
 	v, ok := obj.(map[string]interface{})
 	if !ok {
 		return obj, nil
 	}
 
-	if rfarg == "" {
-		if _, ok := v[field]; ok {
-			return v, nil
-		} else {
-			return nil, errNotFound
-		}
+	sv, ok := v[field]
+	if !ok {
+		return nil, errNotFound
+	}
+	if len(rf) == 0 {
+		return v, nil
 	}
 
-	subobj, err := filter(v[field], root, rfarg)
+	subobj, err := filter(sv, root, rf)
 	if err != nil {
 		return nil, err
 	}
@@ -184,8 +374,8 @@ func filterExplicitField(obj, root interface{}, farg, field string) (interface{}
 	return v, nil
 }
 
-func filterMulti(obj, root interface{}, farg string, filters []string) (interface{}, error) {
-	// log.Printf("fm: %q", filters)
+func filterMulti(obj, root interface{}, filters [][]step) (interface{}, error) {
+	// log.Printf("fm: %v", filters)
 	for _, f := range filters {
 		var err error
 		// the root of a multi's sub-expressions is this obj
@@ -197,25 +387,69 @@ func filterMulti(obj, root interface{}, farg string, filters []string) (interfac
 	return obj, nil
 }
 
-func filterCut(obj, root interface{}, farg string, includes []string) (interface{}, error) {
-	// log.Printf("fc: %v %q %q", obj, farg, includes)
+// filterCall filters what a function returns, but passes along obj itself.
+func filterCall(obj, root interface{}, rf []step, c call) (interface{}, error) {
+	v, err := getCall(obj, nil, c)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := filter(v, root, rf); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// filterNegation and filterAlternation try filters on a copy of obj, since
+// filters trim what they pass through and a rejected filter shouldn't trim
+// anything.
+func filterNegation(obj, root interface{}, rf []step) (interface{}, error) {
+	if _, err := filter(copyValue(obj), root, rf); err == nil {
+		return nil, errNotMatched
+	}
+	return obj, nil
+}
+
+func filterAlternation(obj, root interface{}, filters [][]step) (interface{}, error) {
+	// log.Printf("fa: %v", filters)
+	for _, f := range filters {
+		if r, err := filter(copyValue(obj), root, f); err == nil {
+			return r, nil
+		}
+	}
+	return nil, errNotMatched
+}
+
+func filterCut(obj, root interface{}, includes []string, indices []step, patterns []*regexp.Regexp) (interface{}, error) {
+	// log.Printf("fc: %v %q", obj, includes)
 	switch v := obj.(type) {
 	case []interface{}:
 		var r []interface{}
-		for _, inc := range includes {
-			index, err := strconv.ParseInt(inc, 10, 64)
-			idx := int(index)
-			if err != nil {
+		for _, index := range indices {
+			switch s := index.(type) {
+			case explicitIndex:
+				if idx, ok := resolveIndex(s.index, len(v)); ok {
+					r = append(r, v[idx])
+				}
+			case slice:
+				for _, idx := range s.indices(len(v)) {
+					r = append(r, v[idx])
+				}
+			default:
 				return nil, errIllegalOp
 			}
-			if idx < len(v) {
-				r = append(r, v[idx])
-			}
 		}
 		return r, nil
 	case map[string]interface{}:
 		r := map[string]interface{}{}
-		for _, inc := range includes {
+		for i, inc := range includes {
+			if re := patterns[i]; re != nil {
+				for key, sv := range v {
+					if re.MatchString(key) {
+						r[key] = sv
+					}
+				}
+				continue
+			}
 			if sv, ok := v[inc]; ok {
 				// log.Printf("including %q", inc)
 				r[inc] = sv
@@ -127,6 +127,177 @@ func TestValue(t *testing.T) {
 		args:         []string{`f:.x=".y"`},
 		expectedJSON: `{"x":".y","y":"something else"}`,
 	})
+
+	// true, false and null match the json literals
+	testCase(t, tc{
+		name:         "boolean match",
+		input:        `[{"preemptible":true},{"preemptible":false}]`,
+		args:         []string{"f:[].preemptible=true"},
+		expectedJSON: `[{"preemptible":true}]`,
+	})
+	testCase(t, tc{
+		name:         "null match",
+		input:        `[{"deletedAt":null},{"deletedAt":"yesterday"},{}]`,
+		args:         []string{"f:[].deletedAt=null"},
+		expectedJSON: `[{"deletedAt":null}]`,
+	})
+	// while quoting them matches strings instead
+	testCase(t, tc{
+		name:         "quoted boolean match",
+		input:        `[{"preemptible":true},{"preemptible":"true"}]`,
+		args:         []string{`f:[].preemptible="true"`},
+		expectedJSON: `[{"preemptible":"true"}]`,
+	})
+}
+
+// TestFunctions demonstrates filtering on what a function returns.
+func TestFunctions(t *testing.T) {
+	// the same functions that transforms use can start a filter, and the
+	// object passes through if what the function returns passes the rest
+	testCase(t, tc{
+		name:         "numbers in strings",
+		input:        `[{"diskSizeGb":"100"},{"diskSizeGb":"10"}]`,
+		args:         []string{"f:[]tonumber(.diskSizeGb)>50"},
+		expectedJSON: `[{"diskSizeGb":"100"}]`,
+	})
+	testCase(t, tc{
+		name:         "lengths",
+		input:        `[{"items":[1,2]},{"items":[1]},{"items":{"a":1,"b":2,"c":3}},{"items":"héllo"}]`,
+		args:         []string{"f:[]len(.items)>=2"},
+		expectedJSON: `[{"items":[1,2]},{"items":{"a":1,"b":2,"c":3}},{"items":"héllo"}]`,
+	})
+	testCase(t, tc{
+		name:         "not empty",
+		input:        `[{"labels":{}},{"labels":{"a":"b"}}]`,
+		args:         []string{"f:[]len(.labels)!=0"},
+		expectedJSON: `[{"labels":{"a":"b"}}]`,
+	})
+	testCase(t, tc{
+		name:         "types",
+		input:        `{"a":"x","b":1,"c":{},"d":[],"e":true,"f":null}`,
+		args:         []string{"f:.()type(.)=/^(string|number|object)$/"},
+		expectedJSON: `{"a":"x","b":1,"c":{}}`,
+	})
+}
+
+// TestTypes demonstrates keeping values of a particular json type.
+func TestTypes(t *testing.T) {
+	testCase(t, tc{
+		name:         "list elements",
+		input:        `[{"value":"a"},{"value":1},{"value":["b"]}]`,
+		args:         []string{"f:[].value:string"},
+		expectedJSON: `[{"value":"a"}]`,
+	})
+	testCase(t, tc{
+		name:         "fields",
+		input:        `{"a":"x","b":1,"c":{},"d":[],"e":true,"f":null}`,
+		args:         []string{"f:.():null"},
+		expectedJSON: `{"f":null}`,
+	})
+	testCase(t, tc{
+		name:         "some",
+		input:        `{"items":[1,"two",3]}`,
+		args:         []string{"f:{.items:array,.items[E]:string}"},
+		expectedJSON: `{"items":[1,"two",3]}`,
+	})
+	testCase(t, tc{
+		name:         "not the type",
+		input:        `{"items":{}}`,
+		args:         []string{"f:.items:array"},
+		expectedJSON: ``,
+	})
+	// the type has to be one that json has
+	testCase(t, tc{
+		name:          "unknown type",
+		input:         `{}`,
+		args:          []string{"f:.items:list"},
+		expectedError: `expected one of string, number, object, array, boolean, null after ':'`,
+	})
+}
+
+// TestFieldNames demonstrates how to reach fields with unusual names.
+func TestFieldNames(t *testing.T) {
+	// _ and - are fine in field names
+	testCase(t, tc{
+		name:         "dashed field",
+		input:        `{"startup-script":"/root/start.bash","foo_bar":1}`,
+		args:         []string{"f:.startup-script", "f:.foo_bar=1"},
+		expectedJSON: `{"foo_bar":1,"startup-script":"/root/start.bash"}`,
+	})
+	// anything else can be quoted with ."<field>" or .["<field>"]
+	testCase(t, tc{
+		name:         "quoted field",
+		input:        `{"metadata":{"labels":{"kubernetes.io/hostname":"node-1"}}}`,
+		args:         []string{`f:.metadata.labels."kubernetes.io/hostname"=node-1`},
+		expectedJSON: `{"metadata":{"labels":{"kubernetes.io/hostname":"node-1"}}}`,
+	})
+	testCase(t, tc{
+		name:         "bracketed field",
+		input:        `[{"a b":1},{"a b":2}]`,
+		args:         []string{`f:[].["a b"]=2`},
+		expectedJSON: `[{"a b":2}]`,
+	})
+}
+
+// TestCompare demonstrates comparisons other than equality.
+func TestCompare(t *testing.T) {
+	// anywhere you can use =, you can also use !=, <, <=, > or >=
+	testCase(t, tc{
+		name:         "not equal",
+		input:        `{"status":"RUNNING"}`,
+		args:         []string{"f:.status!=RUNNING"},
+		expectedJSON: "",
+	})
+	testCase(t, tc{
+		name:         "numbers compare as numbers",
+		input:        `[{"cpu":2},{"cpu":8},{"cpu":16}]`,
+		args:         []string{"f:[].cpu>4"},
+		expectedJSON: `[{"cpu":8},{"cpu":16}]`,
+	})
+	testCase(t, tc{
+		name:         "strings compare lexicographically",
+		input:        `["apple","banana","cherry"]`,
+		args:         []string{"f:[]<=banana"},
+		expectedJSON: `["apple","banana"]`,
+	})
+	// a number is never less or more than a string, unless it's quoted
+	testCase(t, tc{
+		name:         "numbers don't compare with strings",
+		input:        `[{"cpu":"9"},{"cpu":"10"},{"cpu":16}]`,
+		args:         []string{"f:[].cpu>4"},
+		expectedJSON: `[{"cpu":16}]`,
+	})
+	// only what json would call a number is one, so nan is a string
+	testCase(t, tc{
+		name:         "not a json number",
+		input:        `["apple","nap","zoo"]`,
+		args:         []string{"f:[]<nan"},
+		expectedJSON: `["apple"]`,
+	})
+	testCase(t, tc{
+		name:         "quoted numbers compare as strings",
+		input:        `[{"cpu":"9"},{"cpu":"10"}]`,
+		args:         []string{`f:[].cpu>"4"`},
+		expectedJSON: `[{"cpu":"9"}]`,
+	})
+	testCase(t, tc{
+		name:         "compare with other values in the object",
+		input:        `{"used":3,"quota":2}`,
+		args:         []string{"f:.used>.quota"},
+		expectedJSON: `{"quota":2,"used":3}`,
+	})
+	testCase(t, tc{
+		name:         "compare inside a multi",
+		input:        `[{"x":1,"y":"a"},{"x":5,"y":"a"},{"x":5,"y":"b"}]`,
+		args:         []string{"f:[]{.x>=2,.y!=b}"},
+		expectedJSON: `[{"x":5,"y":"a"}]`,
+	})
+	testCase(t, tc{
+		name:         "compare under existence",
+		input:        `{"disks":[{"size":10},{"size":100}]}`,
+		args:         []string{"f:.disks[E].size<20"},
+		expectedJSON: `{"disks":[{"size":10},{"size":100}]}`,
+	})
 }
 
 // TestExclusion demonstrates how to filter out part of an object.
@@ -144,6 +315,13 @@ func TestExclusion(t *testing.T) {
 		args:         []string{"f:[].x=y1"},
 		expectedJSON: `[{"w":"z1","x":"y1"}]`,
 	})
+	// a field filter leaves alone anything that isn't a structure
+	testCase(t, tc{
+		name:         "not a structure",
+		input:        `[1,{"x":1},{"x":2}]`,
+		args:         []string{"f:[].x=1"},
+		expectedJSON: `[1,{"x":1}]`,
+	})
 	// even to nothing
 	testCase(t, tc{
 		name:         "complete list exclusion",
@@ -167,6 +345,31 @@ func TestExclusion(t *testing.T) {
 	})
 }
 
+// TestFieldPatterns demonstrates working with families of fields.
+func TestFieldPatterns(t *testing.T) {
+	// .(<glob>) works like .(), but only for fields whose names match
+	testCase(t, tc{
+		name:         "glob fields",
+		input:        `{"env_a":1,"env_b":2,"other":2}`,
+		args:         []string{"f:.(env*)=2"},
+		expectedJSON: `{"env_b":2}`,
+	})
+	// and so does .(/<regexp>/)
+	testCase(t, tc{
+		name:         "regexp fields",
+		input:        `{"label_a":"x","label_b":"y","name":"z"}`,
+		args:         []string{"f:.(/^label_.*/)"},
+		expectedJSON: `{"label_a":"x","label_b":"y"}`,
+	})
+	// the same patterns can be used with @
+	testCase(t, tc{
+		name:         "cut annotations",
+		input:        `{"kubectl.a":1,"kubectl.b":2,"other":3,"name":4}`,
+		args:         []string{"f:@kubectl.*,name"},
+		expectedJSON: `{"kubectl.a":1,"kubectl.b":2,"name":4}`,
+	})
+}
+
 // TestExistence demonstrates how to pass an object through the filter if
 // any part of it matches.
 func TestExistence(t *testing.T) {
@@ -204,6 +407,67 @@ func TestExistence(t *testing.T) {
 	})
 }
 
+// TestUniversal demonstrates how to pass an object through the filter only if
+// every part of it matches.
+func TestUniversal(t *testing.T) {
+	// test if every index matches using [A]
+	testCase(t, tc{
+		name: "simple index universal",
+		input: `
+			{"name":"a","disks":[{"autoDelete":true},{"autoDelete":true}]}
+			{"name":"b","disks":[{"autoDelete":true},{"autoDelete":false}]}
+			`,
+		args:         []string{"f:.disks[A].autoDelete=true", "f:@name"},
+		expectedJSON: `{"name":"a"}`,
+	})
+	// test if every field matches using .(A)
+	testCase(t, tc{
+		name:         "simple field universal",
+		input:        `{"x":2,"y":2,"z":2} {"x":2,"y":3}`,
+		args:         []string{"f:.(A)=2"},
+		expectedJSON: `{"x":2,"y":2,"z":2}`,
+	})
+	// nothing in an empty list can fail to match
+	testCase(t, tc{
+		name:         "empty universal",
+		input:        `[]`,
+		args:         []string{"f:[A]=2"},
+		expectedJSON: `[]`,
+	})
+}
+
+// TestRecursive demonstrates searching at any depth.
+func TestRecursive(t *testing.T) {
+	// ..<field> looks for the field in the object and everything inside it
+	testCase(t, tc{
+		name: "key anywhere",
+		input: `
+			{"name":"a","metadata":{"items":[{"key":"startup-script"}]}}
+			{"name":"b","metadata":{"items":[{"key":"who"}]}}
+			`,
+		args:         []string{"f:..key=startup-script", "f:@name"},
+		expectedJSON: `{"name":"a"}`,
+	})
+	// .** does the same for whatever comes after it
+	testCase(t, tc{
+		name:         "index anywhere",
+		input:        `[{"x":{"y":["a","b"]}},{"x":{"y":["c"]}}]`,
+		args:         []string{"f:[].**[1]=b"},
+		expectedJSON: `[{"x":{"y":["a","b"]}}]`,
+	})
+	// a search only asks whether something is there, so nothing is trimmed
+	// and [] has to keep something to count
+	testCase(t, tc{
+		name: "search with []",
+		input: `
+			{"a":{"items":[{"key":"x"}]},"b":{"items":[{"key":"who"},{"key":"y"}]}}
+			{"a":{"items":[{"key":"x"}]}}
+			`,
+		args:         []string{"f:..items[].key=who"},
+		expectedJSON: `{"a":{"items":[{"key":"x"}]},"b":{"items":[{"key":"who"},{"key":"y"}]}}`,
+	})
+}
+
 // TestMulti lets you test multiple corresponding fields underneath other filters.
 func TestMulti(t *testing.T) {
 	// test multiple values by enclosing them with { and }
@@ -269,6 +533,58 @@ func TestMulti(t *testing.T) {
 	})
 }
 
+// TestLogic demonstrates negating filters and combining them with "or".
+func TestLogic(t *testing.T) {
+	// a filter that starts with ! passes only if the rest of it does not
+	testCase(t, tc{
+		name:         "negated presence",
+		input:        `[{"name":"a","deprecated":true},{"name":"b"}]`,
+		args:         []string{"f:[]!.deprecated"},
+		expectedJSON: `[{"name":"b"}]`,
+	})
+	testCase(t, tc{
+		name:         "negated value",
+		input:        `{"x":[1,2,3]}`,
+		args:         []string{"f:!.x[E]=2"},
+		expectedJSON: "",
+	})
+	testCase(t, tc{
+		name:         "negated existence",
+		input:        `{"x":{"a":1,"b":2},"y":{"a":3}}`,
+		args:         []string{"f:.()!.(E)=2"},
+		expectedJSON: `{"y":{"a":3}}`,
+	})
+
+	// alternatives go between ( and ), separated by |, and the filter passes
+	// if any one of them does
+	testCase(t, tc{
+		name:         "either zone",
+		input:        `[{"zone":"us-east1-b"},{"zone":"us-east1-c"},{"zone":"us-east1-d"}]`,
+		args:         []string{"f:[](.zone=us-east1-b|.zone=us-east1-c)"},
+		expectedJSON: `[{"zone":"us-east1-b"},{"zone":"us-east1-c"}]`,
+	})
+	// and they can be negated, too
+	testCase(t, tc{
+		name:         "neither zone",
+		input:        `[{"zone":"us-east1-b"},{"zone":"us-east1-c"},{"zone":"us-east1-d"}]`,
+		args:         []string{"f:[]!(.zone=us-east1-b|.zone=/-c$/)"},
+		expectedJSON: `[{"zone":"us-east1-d"}]`,
+	})
+	// a filter that is rejected leaves the object as it was
+	testCase(t, tc{
+		name:         "rejected negation",
+		input:        `{"a":{"x":1,"y":2},"b":3}`,
+		args:         []string{"f:!{.a.()=1,.b=2}"},
+		expectedJSON: `{"a":{"x":1,"y":2},"b":3}`,
+	})
+	testCase(t, tc{
+		name:         "rejected alternative",
+		input:        `{"a":{"x":1,"y":2},"b":3}`,
+		args:         []string{"f:({.a.()=1,.b=2}|.b=3)"},
+		expectedJSON: `{"a":{"x":1,"y":2},"b":3}`,
+	})
+}
+
 // TestCut demonstrates how to trim down based on index or field name, rather than value.
 func TestCut(t *testing.T) {
 	// allow only certain fields with @<field>
@@ -323,6 +639,38 @@ func TestCut(t *testing.T) {
 	})
 }
 
+// TestSlice demonstrates counting from the end of a list, and picking out
+// ranges of it.
+func TestSlice(t *testing.T) {
+	// a negative index counts back from the end, so [-1] is the last element
+	testCase(t, tc{
+		name:         "latest entry",
+		input:        `{"log":[{"action":"create"},{"action":"delete"}]}`,
+		args:         []string{"f:.log[-1].action=delete"},
+		expectedJSON: `{"log":[{"action":"create"},{"action":"delete"}]}`,
+	})
+	// [<start>:<end>:<stride>] works like [], but only for part of the list
+	testCase(t, tc{
+		name:         "exclusion in a slice",
+		input:        `[1,2,3,4,5,6]`,
+		args:         []string{"f:[1:5]>2"},
+		expectedJSON: `[3,4,5]`,
+	})
+	testCase(t, tc{
+		name:         "every other element",
+		input:        `[1,2,3,4,5,6]`,
+		args:         []string{"f:[::2]"},
+		expectedJSON: `[1,3,5]`,
+	})
+	// and both can be cut with @
+	testCase(t, tc{
+		name:         "cut the first three and the last",
+		input:        `[1,2,3,4,5,6]`,
+		args:         []string{"f:@:3,-1"},
+		expectedJSON: `[1,2,3,6]`,
+	})
+}
+
 // TestManyFilters demonstrates sequential application of a filters.
 func TestManyFilters(t *testing.T) {
 	// fancy filter, but then we don't need the meta displayed in the output
@@ -370,6 +718,30 @@ func TestManyFilters(t *testing.T) {
 	})
 }
 
+// TestMistakes demonstrates what happens when an argument doesn't make sense.
+func TestMistakes(t *testing.T) {
+	// every argument is checked before any input is read, and the error says
+	// which argument is wrong, where, and what dft expected to find there.
+	testCase(t, tc{
+		name:          "unclosed index",
+		input:         `{"x":[1,2,3]}`,
+		args:          []string{"f:.x", "f:.x[1"},
+		expectedError: `"f:.x\[1" \(argument 2\): expected '\]' after index 1 at offset 6`,
+	})
+	testCase(t, tc{
+		name:          "missing value",
+		input:         `{"x":[1,2,3]}`,
+		args:          []string{"f:{.x,}"},
+		expectedError: `expected a filter at offset 6\n\tf:{\.x,}\n\t      \^`,
+	})
+	testCase(t, tc{
+		name:          "unknown operation",
+		input:         `{"x":[1,2,3]}`,
+		args:          []string{"x:.x"},
+		expectedError: `expected 'f:', 't:', 'o:', 'i:' or '#' at offset 0`,
+	})
+}
+
 // The tutorial ends here.
 
 // What follows is code to make the tests easier to read
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// a decoder reads one object at a time from input, returning io.EOF when
+// there are no more.
+type decoder interface {
+	Decode(v interface{}) error
+}
+
+// inputs are the formats that i:<format> can choose. Without an i:<format>
+// argument, the format is guessed from the start of the input. Formats
+// without types of their own, like csv, can be told to read anything that
+// looks like a number as one with i:<format>,numbers.
+var inputs = map[string]func(in io.Reader, numbers bool) decoder{
+	"json": func(in io.Reader, numbers bool) decoder {
+		return json.NewDecoder(in)
+	},
+	"yaml": func(in io.Reader, numbers bool) decoder {
+		return yamlDecoder{yaml.NewDecoder(in)}
+	},
+	"csv": func(in io.Reader, numbers bool) decoder {
+		return newCSVDecoder(in, ',', numbers)
+	},
+	"tsv": func(in io.Reader, numbers bool) decoder {
+		return newCSVDecoder(in, '\t', numbers)
+	},
+}
+
+func compileInput(iarg string) (operation, error) {
+	if _, _, err := parseInput(iarg); err != nil {
+		return nil, err
+	}
+	// the input format is picked up by apply, so there is nothing to do
+	// for each object
+	return func(out io.Writer, obj interface{}) (interface{}, error) {
+		return obj, nil
+	}, nil
+}
+
+// parseInput splits <format>[,numbers] into its parts.
+func parseInput(iarg string) (format string, numbers bool, err error) {
+	format = iarg
+	if i := strings.IndexByte(iarg, ','); i != -1 {
+		format = iarg[:i]
+		if iarg[i+1:] != "numbers" || (format != "csv" && format != "tsv") {
+			return "", false, &syntaxError{offset: i, msg: fmt.Sprintf("unexpected %q", iarg[i:])}
+		}
+		numbers = true
+	}
+	if _, ok := inputs[format]; !ok {
+		return "", false, &syntaxError{msg: fmt.Sprintf("unknown input format %q", format)}
+	}
+	return format, numbers, nil
+}
+
+// newDecoder reads in with the format chosen by the last i:<format> in args,
+// or guesses it.
+func newDecoder(in io.Reader, args []string) decoder {
+	for i := len(args) - 1; i >= 0; i-- {
+		if strings.HasPrefix(args[i], "i:") {
+			// compileArgs has already checked it
+			format, numbers, _ := parseInput(strings.TrimPrefix(args[i], "i:"))
+			return inputs[format](in, numbers)
+		}
+	}
+	return guessInput(in)
+}
+
+// guessInput reads json if the input starts with a json value, and yaml
+// otherwise. Flow style yaml like {a: 1} starts off looking like json, so
+// the first value has to be read to be sure.
+func guessInput(in io.Reader) decoder {
+	br := bufio.NewReader(in)
+	c, ok := firstByte(br, 0)
+	if !ok {
+		// empty input is empty in any format
+		return json.NewDecoder(br)
+	}
+	if !strings.ContainsRune(`{["-0123456789`, rune(c)) {
+		return inputs["yaml"](br, false)
+	}
+
+	// remember what json reads, to hand it to yaml if it isn't json after all
+	var seen bytes.Buffer
+	dec := json.NewDecoder(io.TeeReader(br, &seen))
+	var first interface{}
+	if err := dec.Decode(&first); err == nil && !keyNext(dec, br) {
+		return &firstDecoder{first: first, dec: dec}
+	}
+	return inputs["yaml"](io.MultiReader(&seen, br), false)
+}
+
+// firstByte peeks past n bytes of whitespace at the first byte of something
+// else, one byte at a time so that input that trickles in isn't held up.
+func firstByte(br *bufio.Reader, n int) (byte, bool) {
+	for ; ; n++ {
+		b, _ := br.Peek(n + 1)
+		if len(b) <= n {
+			return 0, false
+		}
+		if !unicode.IsSpace(rune(b[n])) {
+			return b[n], true
+		}
+	}
+}
+
+// keyNext reports whether the value dec just read is followed by a ':',
+// which makes it the first key of a yaml structure, like "a": 1 or 1: x.
+func keyNext(dec *json.Decoder, br *bufio.Reader) bool {
+	buffered, _ := io.ReadAll(dec.Buffered())
+	for _, c := range buffered {
+		if !unicode.IsSpace(rune(c)) {
+			return c == ':'
+		}
+	}
+	c, ok := firstByte(br, 0)
+	return ok && c == ':'
+}
+
+// firstDecoder hands back the value guessInput already read before reading
+// any more.
+type firstDecoder struct {
+	first interface{}
+	read  bool
+	dec   *json.Decoder
+}
+
+func (fd *firstDecoder) Decode(v interface{}) error {
+	if fd.read {
+		return fd.dec.Decode(v)
+	}
+	ptr, ok := v.(*interface{})
+	if !ok {
+		return fmt.Errorf("can only decode into an interface{}")
+	}
+	*ptr, fd.read = fd.first, true
+	return nil
+}
+
+// yamlDecoder reads a stream of yaml documents, separated by ---, and turns
+// each into the same kinds of values that json would have.
+type yamlDecoder struct {
+	dec *yaml.Decoder
+}
+
+func (yd yamlDecoder) Decode(v interface{}) error {
+	ptr, ok := v.(*interface{})
+	if !ok {
+		return fmt.Errorf("can only decode yaml into an interface{}")
+	}
+	for {
+		var doc yaml.Node
+		if err := yd.dec.Decode(&doc); err != nil {
+			return err
+		}
+		obj, err := fromYAML(&doc)
+		if err != nil {
+			return err
+		}
+		// an empty document, like one after a trailing ---, has nothing
+		// to apply to
+		if obj == nil {
+			continue
+		}
+		*ptr = obj
+		return nil
+	}
+}
+
+// fromYAML makes keys into strings and numbers into float64s, which is what
+// filters and transforms expect. Scalars that json has no type for, like
+// timestamps, .inf and .nan, are kept as they were written.
+func fromYAML(n *yaml.Node) (interface{}, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return fromYAML(n.Content[0])
+	case yaml.AliasNode:
+		return fromYAML(n.Alias)
+	case yaml.SequenceNode:
+		r := make([]interface{}, len(n.Content))
+		for i, sub := range n.Content {
+			subobj, err := fromYAML(sub)
+			if err != nil {
+				return nil, err
+			}
+			r[i] = subobj
+		}
+		return r, nil
+	case yaml.MappingNode:
+		r := map[string]interface{}{}
+		if err := mergeYAML(r, n); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		if err := n.Decode(&b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	case "!!int", "!!float":
+		var f float64
+		if err := n.Decode(&f); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f, nil
+		}
+	}
+	return n.Value, nil
+}
+
+// mergeYAML adds the fields of a mapping node to r, including any merged in
+// with <<. Fields written out in the mapping win over merged ones.
+func mergeYAML(r map[string]interface{}, n *yaml.Node) error {
+	var merges []*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+		if key.Kind != yaml.ScalarNode {
+			return fmt.Errorf("line %d: only scalars can be keys", key.Line)
+		}
+		if key.ShortTag() == "!!merge" {
+			merges = append(merges, val)
+			continue
+		}
+		subobj, err := fromYAML(val)
+		if err != nil {
+			return err
+		}
+		r[key.Value] = subobj
+	}
+	for _, m := range merges {
+		if m.Kind == yaml.AliasNode {
+			m = m.Alias
+		}
+		srcs := []*yaml.Node{m}
+		if m.Kind == yaml.SequenceNode {
+			srcs = m.Content
+		}
+		for _, src := range srcs {
+			if src.Kind == yaml.AliasNode {
+				src = src.Alias
+			}
+			if src.Kind != yaml.MappingNode {
+				return fmt.Errorf("line %d: only mappings can be merged", src.Line)
+			}
+			merged := map[string]interface{}{}
+			if err := mergeYAML(merged, src); err != nil {
+				return err
+			}
+			for key, subobj := range merged {
+				if _, ok := r[key]; !ok {
+					r[key] = subobj
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// csvDecoder reads a row at a time, turning each into a structure whose
+// field names come from the header row.
+type csvDecoder struct {
+	r       *csv.Reader
+	header  []string
+	numbers bool
+}
+
+func newCSVDecoder(in io.Reader, comma rune, numbers bool) *csvDecoder {
+	r := csv.NewReader(in)
+	r.Comma = comma
+	return &csvDecoder{r: r, numbers: numbers}
+}
+
+func (cd *csvDecoder) Decode(v interface{}) error {
+	ptr, ok := v.(*interface{})
+	if !ok {
+		return fmt.Errorf("can only decode csv into an interface{}")
+	}
+	if cd.header == nil {
+		header, err := cd.r.Read()
+		if err != nil {
+			return err
+		}
+		if len(header) > 0 {
+			// spreadsheets often save csv with a byte order mark
+			header[0] = strings.TrimPrefix(header[0], "\ufeff")
+		}
+		cd.header = header
+	}
+	row, err := cd.r.Read()
+	if err != nil {
+		return err
+	}
+	obj := make(map[string]interface{}, len(row))
+	for i, field := range row {
+		obj[cd.header[i]] = cd.value(field)
+	}
+	*ptr = obj
+	return nil
+}
+
+func (cd *csvDecoder) value(field string) interface{} {
+	if cd.numbers {
+		if n, ok := jsonNumber(field); ok {
+			return n
+		}
+	}
+	return field
+}
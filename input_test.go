@@ -0,0 +1,183 @@
+package main
+
+import (
+	"testing"
+)
+
+// This test file is intended to be read from top to bottom as a tutorial
+// on dft input.
+
+// TestYAML demonstrates reading yaml instead of json.
+func TestYAML(t *testing.T) {
+	// input that doesn't start like json is read as yaml, and each
+	// document in it is handled like a separate json object
+	testCase(t, tc{
+		name: "documents",
+		input: dedent(`
+			kind: Pod
+			metadata:
+			  name: a
+			  labels:
+			    app: web
+			---
+			kind: Service
+			metadata:
+			  name: b
+			`),
+		args:         []string{"f:.kind=Pod", "f:@metadata"},
+		expectedJSON: `{"metadata":{"labels":{"app":"web"},"name":"a"}}`,
+	})
+	// yaml numbers become json numbers, and every key becomes a string
+	testCase(t, tc{
+		name: "values",
+		input: dedent(`
+			---
+			replicas: 3
+			ports:
+			- 80
+			- 443
+			1: one
+			`),
+		args:         []string{"f:.replicas>2"},
+		expectedJSON: `{"1":"one","ports":[80,443],"replicas":3}`,
+	})
+	// only true and false are booleans, and anything json can't hold, like
+	// a timestamp or .inf, stays as it was written
+	testCase(t, tc{
+		name: "scalars",
+		input: dedent(`
+			answers: [yes, no, on, off, y, n, true]
+			created: 2001-12-14t21:59:43.10-05:00
+			limit: .inf
+			`),
+		expectedJSON: `{"answers":["yes","no","on","off","y","n",true],"created":"2001-12-14t21:59:43.10-05:00","limit":".inf"}`,
+	})
+	// a structure can start with a quoted key
+	testCase(t, tc{
+		name:         "quoted key",
+		input:        `"a": 1`,
+		expectedJSON: `{"a":1}`,
+	})
+	// so can a structure whose first key is a number
+	testCase(t, tc{
+		name:         "number key",
+		input:        "1: x\n2: y\n",
+		expectedJSON: `{"1":"x","2":"y"}`,
+	})
+	// flow style yaml starts off looking like json, but is read as yaml
+	// once it turns out not to be json
+	testCase(t, tc{
+		name:         "flow structure",
+		input:        `{a: 1}`,
+		expectedJSON: `{"a":1}`,
+	})
+	testCase(t, tc{
+		name:         "flow list",
+		input:        `[x, y]`,
+		expectedJSON: `["x","y"]`,
+	})
+	// anchors and merges are filled in
+	testCase(t, tc{
+		name: "merges",
+		input: dedent(`
+			defaults: &defaults
+			  image: base
+			  retries: 1
+			job:
+			  <<: *defaults
+			  retries: 3
+			`),
+		args:         []string{"f:@job"},
+		expectedJSON: `{"job":{"image":"base","retries":3}}`,
+	})
+	// i:yaml reads yaml even when it looks like json
+	testCase(t, tc{
+		name:         "choose yaml",
+		input:        `{"a": 1, "b": [x, y]}`,
+		args:         []string{"i:yaml"},
+		expectedJSON: `{"a":1,"b":["x","y"]}`,
+	})
+	// and i:json does the opposite
+	testCase(t, tc{
+		name:          "choose json",
+		input:         `a: 1`,
+		args:          []string{"i:json"},
+		expectedError: `error reading stdin`,
+	})
+	testCase(t, tc{
+		name:          "unknown format",
+		input:         `{}`,
+		args:          []string{"i:xml"},
+		expectedError: `unknown input format "xml"`,
+	})
+}
+
+// TestCSV demonstrates reading spreadsheets, where each row becomes an
+// object with fields named by the header row.
+func TestCSV(t *testing.T) {
+	testCase(t, tc{
+		name: "rows",
+		input: dedent(`
+			name,zone,size
+			a,us-east1,10
+			"b, the second",us-west1,20
+			`),
+		args:         []string{"i:csv", "f:.zone=us-west1"},
+		expectedJSON: `{"name":"b, the second","size":"20","zone":"us-west1"}`,
+	})
+	// with i:csv,numbers anything that looks like a number is one
+	testCase(t, tc{
+		name: "numbers",
+		input: dedent(`
+			name,size
+			a,10
+			b,20
+			c,nan
+			`),
+		args:         []string{"i:csv,numbers", "f:.size>15"},
+		expectedJSON: `{"name":"b","size":20}`,
+	})
+	testCase(t, tc{
+		name: "not numbers",
+		input: dedent(`
+			name,size
+			a,nan
+			b,0x10
+			`),
+		args: []string{"i:csv,numbers", "f:.size:string", "f:@size"},
+		expectedOutput: `
+			{
+			  "size": "nan"
+			}
+			{
+			  "size": "0x10"
+			}
+			`,
+	})
+	// i:tsv is the same, but with tabs between fields
+	testCase(t, tc{
+		name:         "tabs",
+		input:        "name\tsize\na\t10\n",
+		args:         []string{"i:tsv,numbers", "t:{.size=.size*2}"},
+		expectedJSON: `{"name":"a","size":20}`,
+	})
+	// a byte order mark isn't part of the first field name
+	testCase(t, tc{
+		name:         "byte order mark",
+		input:        "\ufeffname,size\na,10\n",
+		args:         []string{"i:csv", "f:.name=a"},
+		expectedJSON: `{"name":"a","size":"10"}`,
+	})
+	testCase(t, tc{
+		name:          "short row",
+		input:         "name,size\na\n",
+		args:          []string{"i:csv"},
+		expectedError: `wrong number of fields`,
+	})
+	testCase(t, tc{
+		name:          "numbers only for csv",
+		input:         `{}`,
+		args:          []string{"i:json,numbers"},
+		expectedError: `unexpected ",numbers"`,
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// outputYAML writes each object as a yaml document, with --- between them.
+func outputYAML() operation {
+	first := true
+	return func(out io.Writer, obj interface{}) (interface{}, error) {
+		var b bytes.Buffer
+		enc := yaml.NewEncoder(&b)
+		enc.SetIndent(2)
+		if err := enc.Encode(obj); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		if !first {
+			fmt.Fprintln(out, "---")
+		}
+		first = false
+		_, err := b.WriteTo(out)
+		return nil, err
+	}
+}
+
+// outputCSV writes the columns named after prefix in oarg, with a header row
+// before the first object and then a row for each object, or for each element
+// of an object that is a list.
+func outputCSV(oarg, prefix string, comma rune) (operation, error) {
+	cols, err := compileColumns(oarg, len(prefix))
+	if err != nil {
+		return nil, err
+	}
+	first := true
+	return func(out io.Writer, obj interface{}) (interface{}, error) {
+		w := csv.NewWriter(out)
+		w.Comma = comma
+		if first {
+			header := make([]string, len(cols))
+			for i, col := range cols {
+				header[i] = col.header
+			}
+			w.Write(header)
+			first = false
+		}
+		for _, row := range rows(obj) {
+			r, _ := cells(row, cols)
+			w.Write(r)
+		}
+		w.Flush()
+		return nil, w.Error()
+	}, nil
+}
+
+// rows are the elements of a list, or else just obj.
+func rows(obj interface{}) []interface{} {
+	if v, ok := obj.([]interface{}); ok {
+		return v
+	}
+	return []interface{}{obj}
+}
+
+// cells finds each column's value in row, leaving the cell empty and
+// reporting it as not found if it isn't there.
+func cells(row interface{}, cols []column) ([]string, []bool) {
+	r := make([]string, len(cols))
+	found := make([]bool, len(cols))
+	for i, col := range cols {
+		v, err := getValue(row, col.from)
+		if err != nil {
+			continue
+		}
+		found[i] = true
+		if s, ok := v.(string); ok {
+			r[i] = s
+		} else {
+			r[i] = jsonString(v)
+		}
+	}
+	return r, found
+}
+
+// outputTable holds on to the columns named after prefix in oarg for every
+// object, or every element of an object that is a list, and then writes them
+// all lined up under their headers.
+func outputTable(oarg, prefix string) (operation, flush, error) {
+	cols, err := compileColumns(oarg, len(prefix))
+	if err != nil {
+		return nil, nil, err
+	}
+	var table [][]string
+	op := func(out io.Writer, obj interface{}) (interface{}, error) {
+		for _, row := range rows(obj) {
+			r, found := cells(row, cols)
+			for i := range r {
+				if !found[i] {
+					r[i] = "<none>"
+				}
+			}
+			table = append(table, r)
+		}
+		return nil, nil
+	}
+	fl := func(out io.Writer) error {
+		w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+		header := make([]string, len(cols))
+		for i, col := range cols {
+			header[i] = col.header
+		}
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+		for _, row := range table {
+			for i, cell := range row {
+				// anything that would start a new cell or line goes
+				// in as a space
+				row[i] = strings.Map(func(c rune) rune {
+					if c == '\t' || c == '\n' || c == '\r' {
+						return ' '
+					}
+					return c
+				}, cell)
+			}
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		return w.Flush()
+	}
+	return op, fl, nil
+}
@@ -23,6 +23,132 @@ func TestTemplates(t *testing.T) {
 	// hard to have a unit test that explicitly uses the filesystem.
 }
 
+// TestYAMLOutput demonstrates writing yaml instead of json.
+func TestYAMLOutput(t *testing.T) {
+	// o:yaml writes each object as a yaml document, with --- between them
+	testCase(t, tc{
+		name: "documents",
+		input: `
+			{"kind":"Pod","metadata":{"name":"a","labels":{"app":"web"}},"ports":[80,443]}
+			{"kind":"Service","metadata":{"name":"b"}}
+			`,
+		args: []string{"o:yaml"},
+		expectedOutput: `
+			kind: Pod
+			metadata:
+			  labels:
+			    app: web
+			  name: a
+			ports:
+			  - 80
+			  - 443
+			---
+			kind: Service
+			metadata:
+			  name: b
+			`,
+	})
+	// strings that older yaml would read as something else are quoted
+	testCase(t, tc{
+		name:  "quoted strings",
+		input: `{"answer":"yes","port":"80","enabled":true}`,
+		args:  []string{"o:yaml"},
+		expectedOutput: `
+			answer: "yes"
+			enabled: true
+			port: "80"
+			`,
+	})
+	// objects that don't make it through the filters are left out
+	testCase(t, tc{
+		name:  "filtered documents",
+		input: `{"x":1} {"x":2} {"x":3}`,
+		args:  []string{"f:.x!=2", "o:yaml"},
+		expectedOutput: `
+			x: 1
+			---
+			x: 3
+			`,
+	})
+}
+
+// TestCSVOutput demonstrates writing a spreadsheet.
+func TestCSVOutput(t *testing.T) {
+	// o:csv=<source>,<source>,... writes a header, and then a row for each
+	// element of a list
+	testCase(t, tc{
+		name: "list",
+		input: `[
+			{"name":"a","zone":"us-east1","metadata":{"items":[{"value":"x"}]}},
+			{"name":"b, the second","zone":"us-west1","size":20}
+			]`,
+		args: []string{"o:csv=.name,.zone,.metadata.items[0].value,.size"},
+		expectedOutput: `
+			.name,.zone,.metadata.items[0].value,.size
+			a,us-east1,x,
+			"b, the second",us-west1,,20
+			`,
+	})
+	// or for each object, with the header only once
+	testCase(t, tc{
+		name:  "objects",
+		input: `{"x":1,"y":"one"} {"x":2,"y":"two"}`,
+		args:  []string{"o:tsv=.y,.x*10"},
+		expectedOutput: `
+			.y	.x*10
+			one	10
+			two	20
+			`,
+	})
+	testCase(t, tc{
+		name:          "no columns",
+		input:         `{}`,
+		args:          []string{"o:csv=.x,"},
+		expectedError: `expected a column at offset 9`,
+	})
+}
+
+// TestTableOutput demonstrates lining up columns for the terminal.
+func TestTableOutput(t *testing.T) {
+	// o:table=<source>,<source>,... waits for all of the input, and then
+	// writes a row for every object or element of a list
+	testCase(t, tc{
+		name: "table",
+		input: `
+			[{"name":"web-1","status":"RUNNING","zone":"us-east1-b"}]
+			[{"name":"database","status":"STOPPED"}]
+			`,
+		args: []string{"o:table=.name,.status,.zone"},
+		expectedOutput: `
+			.name      .status   .zone
+			web-1      RUNNING   us-east1-b
+			database   STOPPED   <none>
+			`,
+	})
+	// a column that isn't there is <none>, unlike one that is empty
+	testCase(t, tc{
+		name:  "empty and missing",
+		input: `{"name":"a","zone":"","status":"ok"} {"name":"b","status":"ok"}`,
+		args:  []string{"o:table=NAME:.name,ZONE:.zone,STATUS:.status"},
+		expectedOutput: `
+			NAME   ZONE     STATUS
+			a               ok
+			b      <none>   ok
+			`,
+	})
+	// columns can be given a header with <header>:<source>
+	testCase(t, tc{
+		name:  "headers",
+		input: `{"name":"a","disks":[1,2,3]} {"name":"bb","disks":[]}`,
+		args:  []string{"o:table=NAME:.name,DISKS:len(.disks)"},
+		expectedOutput: `
+			NAME   DISKS
+			a      3
+			bb     0
+			`,
+	})
+}
+
 // TestManyObjects demonstrates how a series of json objects on input will
 // result in a series of dft applications to output.
 func TestManyObjects(t *testing.T) {
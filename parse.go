@@ -0,0 +1,1345 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Every argument is compiled once, before any input is read, into a list of
+// steps. filter, transform, getValue and setValue dispatch on the type of
+// the first step and hand the rest of the list to whatever comes next, the
+// same way they used to hand over the rest of the argument string.
+type step interface{}
+
+// a path is a list of explicitIndex and explicitField steps, naming exactly
+// one place in an object.
+type path []step
+
+// a json value, which can only begin a path
+type literal struct {
+	value interface{}
+}
+
+// <name>(<arg>,<arg>,...), which can only begin a path
+type call struct {
+	name string
+	args []path
+}
+
+// /<regexp>/, which can only be an argument to a function
+type regexpArg struct {
+	re *regexp.Regexp
+}
+
+// <left> <op> <right>, for any of + - * / %, which can only begin a path
+type binary struct {
+	op          string
+	left, right path
+}
+
+// [<index>], where a negative index counts back from the end
+type explicitIndex struct {
+	index int
+}
+
+// [<start>:<end>:<stride>], any of which may be left out, as in python
+type slice struct {
+	start, end, stride int
+	hasStart, hasEnd   bool
+}
+
+// .<field>
+type explicitField struct {
+	field string
+}
+
+// .** or the first . of ..<field>
+type recursive struct{}
+
+// [], .(), a slice or a field pattern after a recursive step, which passes
+// only if it keeps something, since a search is only asking whether there is
+// anything there
+type anyKept struct {
+	s step
+}
+
+// []
+type allIndices struct{}
+
+// [E]
+type someIndex struct{}
+
+// [A]
+type everyIndex struct{}
+
+// .()
+type allFields struct{}
+
+// .(E)
+type someField struct{}
+
+// .(A)
+type everyField struct{}
+
+// .(/<regexp>/) or .(<glob>)
+type fieldPattern struct {
+	re *regexp.Regexp
+}
+
+// comparisons are what may join a filter to the value it is checked
+// against, longest first so that "<=" isn't mistaken for "<".
+var comparisons = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+// =<value>, or any other comparison
+type exactValue struct {
+	op string
+	// vstr is the value with any enclosing quotes or slashes removed.
+	vstr   string
+	quoted bool
+	// num is set when vstr parses as a number.
+	num   float64
+	isNum bool
+	re    *regexp.Regexp
+}
+
+// =<path>, or any other comparison
+type lookupValue struct {
+	op   string
+	from path
+}
+
+// :<type>, for any of the names typeName gives
+type typeTest struct {
+	name string
+}
+
+// typeNames are the json types a typeTest can check for.
+var typeNames = []string{"string", "number", "object", "array", "boolean", "null"}
+
+// {<filter>,<filter>,...}
+type multi struct {
+	filters [][]step
+}
+
+// !<filter>
+type negation struct{}
+
+// (<filter>|<filter>|...)
+type alternation struct {
+	filters [][]step
+}
+
+// @<include>,<include>,...
+type cut struct {
+	includes []string
+	// indices holds the explicitIndex or slice each include stands for
+	// when cutting a list, or nil if it doesn't stand for one.
+	indices []step
+	// patterns holds the field names each include matches when cutting a
+	// structure, or nil if it is a plain field name.
+	patterns []*regexp.Regexp
+}
+
+// {<to>=<from>}, {<to><-<from>} to move rather than copy, or {<to>?=<from>}
+// to only fill in a destination that isn't there yet
+type replacement struct {
+	op       string
+	to, from path
+}
+
+// {-<path>}
+type deletion struct {
+	at path
+}
+
+// a column of tabular output, which is whatever from names in each object
+type column struct {
+	header string
+	from   path
+}
+
+// a syntaxError points at the place in an argument where compiling it went
+// wrong, and says what was expected there.
+type syntaxError struct {
+	arg string
+	// argn counts arguments from 1, like the shell does.
+	argn   int
+	offset int
+	msg    string
+}
+
+func (err *syntaxError) Error() string {
+	caret := strings.Repeat(" ", utf8.RuneCountInString(err.arg[:err.offset]))
+	return fmt.Sprintf("error with %q (argument %d): %s at offset %d\n\t%s\n\t%s^",
+		err.arg, err.argn, err.msg, err.offset, err.arg, caret)
+}
+
+// shift moves a syntax error's offset along by the length of whatever
+// prefix was trimmed off before parsing.
+func shift(err error, prefix string) error {
+	if serr, ok := err.(*syntaxError); ok {
+		serr.offset += len(prefix)
+	}
+	return err
+}
+
+type parser struct {
+	src string
+	pos int
+	// stops are the characters that end a bare value or a path, which
+	// depends on what the parser is nested inside of.
+	stops string
+}
+
+func compileFilter(farg string) ([]step, error) {
+	p := &parser{src: farg}
+	if farg == "" {
+		return nil, p.errorf("expected a filter")
+	}
+	f, err := p.filter()
+	if err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.rest())
+	}
+	return f, nil
+}
+
+func compileTransform(targ string) ([]step, error) {
+	p := &parser{src: targ}
+	if targ == "" {
+		return nil, p.errorf("expected a transform")
+	}
+	return p.transform()
+}
+
+// compileColumns parses [<header>:]<source>,... starting at start, heading
+// each column with the source as it was written if there is no header.
+func compileColumns(src string, start int) ([]column, error) {
+	p := &parser{src: src, pos: start, stops: ","}
+	var cols []column
+	for {
+		header := p.header()
+		colStart := p.pos
+		from, err := p.sourcePath()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos == colStart {
+			return nil, p.errorf("expected a column")
+		}
+		if !p.atStop() {
+			return nil, p.errorf("expected ',' after column")
+		}
+		if header == "" {
+			header = strings.TrimSpace(src[colStart:p.pos])
+		}
+		cols = append(cols, column{header: header, from: from})
+		if p.eof() {
+			return cols, nil
+		}
+		p.accept(",")
+	}
+}
+
+// header parses <header>: at the start of a column, if it's there. A header
+// can't have anything in it that a source could.
+func (p *parser) header() string {
+	end := p.pos
+	for end < len(p.src) && !strings.ContainsRune(`.[("',:`, rune(p.src[end])) {
+		end++
+	}
+	if end == p.pos || end == len(p.src) || p.src[end] != ':' {
+		return ""
+	}
+	header := p.src[p.pos:end]
+	p.pos = end + 1
+	return header
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &syntaxError{
+		offset: p.pos,
+		msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) rest() string {
+	return p.src[p.pos:]
+}
+
+// atStop reports whether the parser is at the end of what it is currently
+// nested inside of.
+func (p *parser) atStop() bool {
+	return p.eof() || strings.IndexByte(p.stops, p.src[p.pos]) != -1
+}
+
+// upto returns the text from the current position to the next stop.
+func (p *parser) upto() string {
+	end := p.pos
+	for end < len(p.src) && strings.IndexByte(p.stops, p.src[end]) == -1 {
+		end++
+	}
+	return p.src[p.pos:end]
+}
+
+func (p *parser) peek(c byte) bool {
+	return !p.eof() && p.src[p.pos] == c
+}
+
+func (p *parser) accept(s string) bool {
+	if strings.HasPrefix(p.rest(), s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// nest parses with stops in place of the current ones, restoring them
+// afterwards.
+func (p *parser) nest(stops string, parse func() error) error {
+	saved := p.stops
+	p.stops = stops
+	err := parse()
+	p.stops = saved
+	return err
+}
+
+func (p *parser) filter() ([]step, error) {
+	var f []step
+	for !p.atStop() {
+		switch {
+		case p.comparison() != "":
+			op := p.comparison()
+			p.accept(op)
+			if p.peek('.') || p.peek('[') {
+				from, err := p.sourcePath()
+				if err != nil {
+					return nil, err
+				}
+				return append(f, lookupValue{op: op, from: from}), nil
+			}
+			start := p.pos
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			v.op = op
+			if v.re != nil && op != "=" && op != "!=" {
+				p.pos = start
+				return nil, p.errorf("a regular expression can only be compared with '=' or '!='")
+			}
+			return append(f, v), nil
+
+		case p.accept("[]"):
+			f = append(f, allIndices{})
+		case p.accept("[E]"):
+			f = append(f, someIndex{})
+		case p.accept("[A]"):
+			f = append(f, everyIndex{})
+
+		case p.accept(".()"):
+			f = append(f, allFields{})
+		case p.accept(".(E)"):
+			f = append(f, someField{})
+		case p.accept(".(A)"):
+			f = append(f, everyField{})
+		case strings.HasPrefix(p.rest(), ".("):
+			fp, err := p.fieldPattern()
+			if err != nil {
+				return nil, err
+			}
+			f = append(f, fp)
+
+		case p.recursive():
+			rest, err := p.filter()
+			if err != nil {
+				return nil, err
+			}
+			return append(append(f, recursive{}), searched(rest)...), nil
+
+		case p.peek('['):
+			index, err := p.index()
+			if err != nil {
+				return nil, err
+			}
+			f = append(f, index)
+		case p.peek('.'):
+			field, err := p.field()
+			if err != nil {
+				return nil, err
+			}
+			f = append(f, field)
+
+		case p.accept("{"):
+			m, err := p.multi()
+			if err != nil {
+				return nil, err
+			}
+			return append(f, m), nil
+
+		case p.callName() != "":
+			c, err := p.call()
+			if err != nil {
+				return nil, err
+			}
+			f = append(f, c)
+
+		case p.accept("("):
+			a, err := p.alternation()
+			if err != nil {
+				return nil, err
+			}
+			return append(f, a), nil
+
+		case p.accept("!"):
+			rest, err := p.filter()
+			if err != nil {
+				return nil, err
+			}
+			if len(rest) == 0 {
+				return nil, p.errorf("expected a filter after '!'")
+			}
+			return append(append(f, negation{}), rest...), nil
+
+		case p.accept("@"):
+			c, err := p.cut()
+			if err != nil {
+				return nil, err
+			}
+			return append(f, c), nil
+
+		case p.accept(":"):
+			tt, err := p.typeTest()
+			if err != nil {
+				return nil, err
+			}
+			return append(f, tt), nil
+
+		default:
+			return nil, p.errorf("expected a comparison, '.', '[', '{', '(', '!', '@' or ':'")
+		}
+	}
+	return f, nil
+}
+
+// typeTest parses the name of a json type after a ':'.
+func (p *parser) typeTest() (typeTest, error) {
+	for _, name := range typeNames {
+		if p.accept(name) {
+			if !p.atStop() {
+				p.pos -= len(name)
+				break
+			}
+			return typeTest{name: name}, nil
+		}
+	}
+	return typeTest{}, p.errorf("expected one of %s after ':'", strings.Join(typeNames, ", "))
+}
+
+// searched makes the steps of a filter that trim what they pass, so that
+// they only pass if they keep something.
+func searched(f []step) []step {
+	r := make([]step, len(f))
+	for i, st := range f {
+		switch s := st.(type) {
+		case allIndices, allFields, slice, fieldPattern:
+			st = anyKept{s: s}
+		case multi:
+			m := multi{}
+			for _, sub := range s.filters {
+				m.filters = append(m.filters, searched(sub))
+			}
+			st = m
+		case alternation:
+			a := alternation{}
+			for _, sub := range s.filters {
+				a.filters = append(a.filters, searched(sub))
+			}
+			st = a
+		}
+		r[i] = st
+	}
+	return r
+}
+
+// literal parses a json value, if there is one at the current position.
+func (p *parser) literal() (literal, bool) {
+	start := p.pos
+	switch {
+	case p.peek('"') || p.peek('{') || p.peek('-'):
+	case !p.eof() && p.src[p.pos] >= '0' && p.src[p.pos] <= '9':
+	case strings.HasPrefix(p.rest(), "true") ||
+		strings.HasPrefix(p.rest(), "false") ||
+		strings.HasPrefix(p.rest(), "null"):
+	case p.peek('['):
+		// [<index>] is a path, not a list
+		if _, err := p.index(); err == nil {
+			p.pos = start
+			return literal{}, false
+		}
+	default:
+		return literal{}, false
+	}
+
+	dec := json.NewDecoder(strings.NewReader(p.rest()))
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return literal{}, false
+	}
+	p.pos += int(dec.InputOffset())
+	// whatever comes next has to make sense after a value
+	if !p.atStop() && !p.peek('.') && !p.peek('[') {
+		p.pos = start
+		return literal{}, false
+	}
+	return literal{value: v}, true
+}
+
+// comparison returns the comparison operator at the current position, if
+// there is one.
+func (p *parser) comparison() string {
+	for _, op := range comparisons {
+		if strings.HasPrefix(p.rest(), op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *parser) multi() (multi, error) {
+	var m multi
+	err := p.nest(",}", func() error {
+		for {
+			sub, err := p.filter()
+			if err != nil {
+				return err
+			}
+			if len(sub) == 0 {
+				return p.errorf("expected a filter")
+			}
+			m.filters = append(m.filters, sub)
+			if p.accept("}") {
+				return nil
+			}
+			if !p.accept(",") {
+				return p.errorf("expected ',' or '}'")
+			}
+		}
+	})
+	return m, err
+}
+
+func (p *parser) alternation() (alternation, error) {
+	var a alternation
+	err := p.nest("|)", func() error {
+		for {
+			sub, err := p.filter()
+			if err != nil {
+				return err
+			}
+			if len(sub) == 0 {
+				return p.errorf("expected a filter")
+			}
+			a.filters = append(a.filters, sub)
+			if p.accept(")") {
+				return nil
+			}
+			if !p.accept("|") {
+				return p.errorf("expected '|' or ')'")
+			}
+		}
+	})
+	return a, err
+}
+
+func (p *parser) cut() (cut, error) {
+	var c cut
+	// inside a multi, the comma separates filters rather than includes
+	separated := strings.IndexByte(p.stops, ',') == -1
+	for {
+		start := p.pos
+		inc := p.uptoAny(",")
+		index, _ := parseIndex(inc)
+		var re *regexp.Regexp
+		if isPattern(inc) {
+			var err error
+			if re, err = compilePattern(inc); err != nil {
+				p.pos = start
+				return c, p.errorf("%v", err)
+			}
+		}
+		c.includes = append(c.includes, inc)
+		c.indices = append(c.indices, index)
+		c.patterns = append(c.patterns, re)
+		if !separated || !p.accept(",") {
+			return c, nil
+		}
+	}
+}
+
+// fieldPattern parses .(/<regexp>/) or .(<glob>).
+func (p *parser) fieldPattern() (fieldPattern, error) {
+	start := p.pos
+	p.accept(".(")
+	pattern := p.pos
+	if p.peek('/') {
+		if end := p.closing('/'); end != -1 {
+			p.pos = end
+		}
+	}
+	for !p.eof() && !p.peek(')') {
+		p.pos++
+	}
+	expr := p.src[pattern:p.pos]
+	if !p.accept(")") {
+		err := p.errorf("expected ')' after field pattern %s", expr)
+		p.pos = start
+		return fieldPattern{}, err
+	}
+	re, err := compilePattern(expr)
+	if err != nil {
+		p.pos = pattern
+		err = p.errorf("%v", err)
+		p.pos = start
+		return fieldPattern{}, err
+	}
+	return fieldPattern{re: re}, nil
+}
+
+// isPattern reports whether a cut's include matches field names, rather
+// than being one.
+func isPattern(inc string) bool {
+	return (len(inc) >= 2 && strings.HasPrefix(inc, "/") && strings.HasSuffix(inc, "/")) ||
+		strings.ContainsAny(inc, "*?")
+}
+
+// compilePattern compiles /<regexp>/ as it is, and anything else as a glob
+// where * matches any run of characters and ? matches any one.
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	if len(expr) >= 2 && strings.HasPrefix(expr, "/") && strings.HasSuffix(expr, "/") {
+		re, err := compileRegexp(expr[1 : len(expr)-1])
+		if err != nil {
+			return nil, fmt.Errorf("bad regular expression: %v", err)
+		}
+		return re, nil
+	}
+	glob := "^"
+	for _, c := range expr {
+		switch c {
+		case '*':
+			glob += ".*"
+		case '?':
+			glob += "."
+		default:
+			glob += regexp.QuoteMeta(string(c))
+		}
+	}
+	return compileRegexp(glob + "$")
+}
+
+// uptoAny consumes and returns the text up to the next stop or any of the
+// given characters.
+func (p *parser) uptoAny(chars string) string {
+	start := p.pos
+	for !p.atStop() && strings.IndexByte(chars, p.src[p.pos]) == -1 {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *parser) index() (step, error) {
+	start := p.pos
+	p.accept("[")
+	spec := p.pos
+	for !p.eof() && strings.IndexByte("-:0123456789", p.src[p.pos]) != -1 {
+		p.pos++
+	}
+	if p.pos == spec {
+		err := p.errorf("expected an index after '['")
+		p.pos = start
+		return nil, err
+	}
+	if !p.accept("]") {
+		err := p.errorf("expected ']' after index %s", p.src[spec:p.pos])
+		p.pos = start
+		return nil, err
+	}
+	index, err := parseIndex(p.src[spec : p.pos-1])
+	if err != nil {
+		p.pos = spec
+		err = p.errorf("bad index: %v", err)
+		p.pos = start
+		return nil, err
+	}
+	return index, nil
+}
+
+// parseIndex turns what goes between [ and ] into an explicitIndex or a
+// slice.
+func parseIndex(spec string) (step, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) == 1 {
+		idx, err := strconv.Atoi(spec)
+		if err != nil {
+			return nil, err
+		}
+		return explicitIndex{index: idx}, nil
+	}
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("too many ':' in %q", spec)
+	}
+
+	s := slice{stride: 1}
+	var err error
+	if parts[0] != "" {
+		if s.start, err = strconv.Atoi(parts[0]); err != nil {
+			return nil, err
+		}
+		s.hasStart = true
+	}
+	if parts[1] != "" {
+		if s.end, err = strconv.Atoi(parts[1]); err != nil {
+			return nil, err
+		}
+		s.hasEnd = true
+	}
+	if len(parts) == 3 && parts[2] != "" {
+		if s.stride, err = strconv.Atoi(parts[2]); err != nil {
+			return nil, err
+		}
+		if s.stride == 0 {
+			return nil, fmt.Errorf("slice stride cannot be zero")
+		}
+	}
+	return s, nil
+}
+
+// indices lists the indices a slice picks out of a list of length n.
+func (s slice) indices(n int) []int {
+	start, end := 0, n
+	if s.stride < 0 {
+		start, end = n-1, -1
+	}
+	if s.hasStart {
+		start = clampIndex(s.start, n, s.stride)
+	}
+	if s.hasEnd {
+		end = clampIndex(s.end, n, s.stride)
+	}
+	var r []int
+	for i := start; (s.stride > 0 && i < end) || (s.stride < 0 && i > end); i += s.stride {
+		r = append(r, i)
+	}
+	return r
+}
+
+func clampIndex(idx, n, stride int) int {
+	if idx < 0 {
+		idx += n
+	}
+	lo, hi := 0, n
+	if stride < 0 {
+		lo, hi = -1, n-1
+	}
+	if idx < lo {
+		return lo
+	}
+	if idx > hi {
+		return hi
+	}
+	return idx
+}
+
+// resolveIndex counts a negative index back from the end of a list of
+// length n, and reports whether the index is inside the list.
+func resolveIndex(idx, n int) (int, bool) {
+	if idx < 0 {
+		idx += n
+	}
+	return idx, idx >= 0 && idx < n
+}
+
+func (p *parser) field() (explicitField, error) {
+	start := p.pos
+	p.accept(".")
+
+	// ."<field>" and .["<field>"] allow any field name at all
+	bracketed := strings.HasPrefix(p.rest(), `["`)
+	if bracketed {
+		p.accept("[")
+	}
+	if p.peek('"') {
+		field, err := p.quoted()
+		if err == nil && bracketed && !p.accept("]") {
+			err = p.errorf("expected ']' after quoted field name")
+		}
+		if err != nil {
+			p.pos = start
+			return explicitField{}, err
+		}
+		return explicitField{field: field}, nil
+	}
+
+	name := p.pos
+	for !p.eof() {
+		c, size := utf8.DecodeRuneInString(p.rest())
+		if !isNameRune(c) {
+			break
+		}
+		p.pos += size
+	}
+	// a trailing - belongs to whatever comes next, so that .a-.b subtracts
+	for p.pos > name && p.src[p.pos-1] == '-' {
+		p.pos--
+	}
+	if p.pos == name {
+		err := p.errorf("expected a field name after '.'")
+		p.pos = start
+		return explicitField{}, err
+	}
+	return explicitField{field: p.src[name:p.pos]}, nil
+}
+
+func isNameRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '-'
+}
+
+// isBareName reports whether field can be written without quotes.
+func isBareName(field string) bool {
+	if field == "" || strings.HasSuffix(field, "-") {
+		return false
+	}
+	for _, c := range field {
+		if !isNameRune(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// quoted parses a double quoted string, with the same escapes as go and
+// json.
+func (p *parser) quoted() (string, error) {
+	end := p.closing('"')
+	if end == -1 {
+		return "", p.errorf("expected a closing '\"'")
+	}
+	s, err := strconv.Unquote(p.src[p.pos:end])
+	if err != nil {
+		return "", p.errorf("bad quoted string: %v", err)
+	}
+	p.pos = end
+	return s, nil
+}
+
+// value parses the right hand side of an =, which is either "<quoted>",
+// /<regexp>/ or a bare value running up to the next stop.
+func (p *parser) value() (exactValue, error) {
+	var v exactValue
+	start := p.pos
+	raw := p.upto()
+	// a quoted value or a regular expression may contain stops, as long as
+	// one comes right after the closing quote or slash
+	if p.peek('"') || p.peek('/') {
+		if end := p.closing(p.src[p.pos]); end != -1 {
+			p.pos = end
+			if p.atStop() {
+				raw = p.src[start:end]
+			}
+			p.pos = start
+		}
+	}
+	p.pos += len(raw)
+	switch {
+	// quoted raw string comparison, to allow strings to begin with
+	// one of the special prefixes: . [ / or to be true, false or null
+	case len(raw) >= 2 && strings.HasPrefix(raw, `"`) && strings.HasSuffix(raw, `"`):
+		v.vstr = raw[1 : len(raw)-1]
+		v.quoted = true
+		return v, nil
+	// regular expression
+	case len(raw) >= 2 && strings.HasPrefix(raw, `/`) && strings.HasSuffix(raw, `/`):
+		v.vstr = raw[1 : len(raw)-1]
+		re, err := compileRegexp(v.vstr)
+		if err != nil {
+			p.pos -= len(raw)
+			return v, p.errorf("bad regular expression: %v", err)
+		}
+		v.re = re
+		return v, nil
+	}
+	v.vstr = raw
+	v.num, v.isNum = jsonNumber(v.vstr)
+	return v, nil
+}
+
+// closing returns the position just past the delimiter that closes the one
+// at the current position, skipping any that are escaped with a backslash.
+func (p *parser) closing(delim byte) int {
+	for i := p.pos + 1; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '\\':
+			i++
+		case delim:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexps[expr]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexps[expr] = re
+	return re, nil
+}
+
+// path parses explicit indices and fields up to the next stop.
+func (p *parser) path() (path, error) {
+	var pth path
+	for !p.atStop() {
+		st, err := p.pathStep()
+		if err != nil {
+			return nil, err
+		}
+		pth = append(pth, st)
+	}
+	return pth, nil
+}
+
+func (p *parser) pathStep() (step, error) {
+	switch {
+	case p.recursive():
+		return recursive{}, nil
+	case p.peek('['):
+		return p.index()
+	case p.peek('.'):
+		return p.field()
+	}
+	return nil, p.errorf("expected '.' or '['")
+}
+
+// arithmetic is what ends an operand in a source.
+const arithmetic = "+-*/%() "
+
+// sourcePath parses a path, which may begin with a literal json value like
+// "prod", 3, [] or {"a":1}, or be arithmetic on other sources.
+func (p *parser) sourcePath() (path, error) {
+	var from path
+	err := p.nest(p.stops+arithmetic, func() error {
+		var err error
+		from, err = p.sum()
+		return err
+	})
+	if serr, ok := err.(*syntaxError); ok {
+		if rest := p.upto(); rest != "" {
+			serr.msg = fmt.Sprintf("cannot use %q as source: %s", rest, serr.msg)
+		}
+		return nil, serr
+	}
+	return from, nil
+}
+
+// sum parses <product> [+-] <product> ...
+func (p *parser) sum() (path, error) {
+	return p.binary(p.product, "+", "-")
+}
+
+// product parses <operand> [*/%] <operand> ...
+func (p *parser) product() (path, error) {
+	return p.binary(p.operand, "*", "/", "%")
+}
+
+func (p *parser) binary(operand func() (path, error), ops ...string) (path, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		var op string
+		for _, o := range ops {
+			if p.accept(o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		p.skipSpace()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if len(right) == 0 {
+			return nil, p.errorf("expected a value after '%s'", op)
+		}
+		left = path{binary{op: op, left: left, right: right}}
+	}
+}
+
+// operand parses a literal or a path, a negated operand, or a sum in
+// parentheses, any of which may be followed by more of a path.
+func (p *parser) operand() (path, error) {
+	p.skipSpace()
+	var from path
+	switch {
+	case p.accept("("):
+		var err error
+		if from, err = p.sum(); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.accept(")") {
+			return nil, p.errorf("expected ')'")
+		}
+	case p.callName() != "":
+		c, err := p.call()
+		if err != nil {
+			return nil, err
+		}
+		from = append(from, c)
+	case p.recursive():
+		// checked first, since * would otherwise end a lone .
+		from = append(from, recursive{})
+	case p.accept("."):
+		// a lone . is the value itself
+		if !p.atStop() || p.peek('(') {
+			p.pos--
+		}
+	default:
+		if lit, ok := p.literal(); ok {
+			from = append(from, lit)
+		} else if p.accept("-") {
+			neg, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			if len(neg) == 0 {
+				return nil, p.errorf("expected a value after '-'")
+			}
+			return path{binary{op: "-", left: path{literal{value: 0.0}}, right: neg}}, nil
+		}
+	}
+	rfrom, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+	return append(from, rfrom...), nil
+}
+
+// callName returns the name of the function called at the current
+// position, if there is one.
+func (p *parser) callName() string {
+	end := p.pos
+	for end < len(p.src) && p.src[end] >= 'a' && p.src[end] <= 'z' {
+		end++
+	}
+	if end == p.pos || end == len(p.src) || p.src[end] != '(' {
+		return ""
+	}
+	return p.src[p.pos:end]
+}
+
+// call parses <name>(<source>,<source>,...).
+func (p *parser) call() (call, error) {
+	start := p.pos
+	c := call{name: p.callName()}
+	fn, ok := functions[c.name]
+	if !ok {
+		return c, p.errorf("unknown function %q", c.name)
+	}
+	p.accept(c.name + "(")
+	err := p.nest(p.stops+arithmetic+",", func() error {
+		var err error
+		p.skipSpace()
+		for !p.accept(")") {
+			if len(c.args) > 0 && !p.accept(",") {
+				return p.errorf("expected ',' or ')'")
+			}
+			var arg path
+			argStart := p.pos
+			if p.peek('/') {
+				re, err := p.regexpArg()
+				if err != nil {
+					return err
+				}
+				arg = path{re}
+			} else if arg, err = p.sum(); err != nil {
+				return err
+			}
+			if len(arg) == 0 && p.pos == argStart {
+				return p.errorf("expected an argument")
+			}
+			c.args = append(c.args, arg)
+			p.skipSpace()
+		}
+		return nil
+	})
+	if err != nil {
+		return c, err
+	}
+	if len(c.args) < fn.minArgs || len(c.args) > fn.maxArgs {
+		p.pos = start
+		return c, p.errorf("%s takes %s, not %d", c.name, fn.arity(), len(c.args))
+	}
+	return c, nil
+}
+
+// regexpArg parses /<regexp>/ as an argument to a function.
+func (p *parser) regexpArg() (regexpArg, error) {
+	end := p.closing('/')
+	if end == -1 {
+		return regexpArg{}, p.errorf("expected a closing '/'")
+	}
+	re, err := compileRegexp(p.src[p.pos+1 : end-1])
+	if err != nil {
+		return regexpArg{}, p.errorf("bad regular expression: %v", err)
+	}
+	p.pos = end
+	return regexpArg{re: re}, nil
+}
+
+func (p *parser) skipSpace() {
+	for p.peek(' ') {
+		p.pos++
+	}
+}
+
+func (p *parser) destinationPath() (path, error) {
+	start := p.pos
+	to, err := p.path()
+	if serr, ok := err.(*syntaxError); ok {
+		serr.msg = fmt.Sprintf("cannot use %q as destination: %s", p.upto(), serr.msg)
+		return nil, serr
+	}
+	for _, st := range to {
+		switch st.(type) {
+		case recursive, slice:
+			text := p.src[start:p.pos]
+			p.pos = start
+			return nil, p.errorf("cannot use %q as destination: it could be many places", text)
+		}
+	}
+	return to, nil
+}
+
+// recursive accepts .**, or the first . of ..<field> so that the field is
+// parsed next.
+func (p *parser) recursive() bool {
+	if p.accept(".**") {
+		return true
+	}
+	if strings.HasPrefix(p.rest(), "..") {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) transform() ([]step, error) {
+	var t []step
+	for !p.eof() {
+		switch {
+		case p.accept("[]"):
+			t = append(t, allIndices{})
+		case p.accept(".()"):
+			t = append(t, allFields{})
+		case strings.HasPrefix(p.rest(), ".("):
+			fp, err := p.fieldPattern()
+			if err != nil {
+				return nil, err
+			}
+			t = append(t, fp)
+
+		case p.peek('['):
+			index, err := p.index()
+			if err != nil {
+				return nil, err
+			}
+			t = append(t, index)
+		case p.peek('.'):
+			field, err := p.field()
+			if err != nil {
+				return nil, err
+			}
+			t = append(t, field)
+
+		case p.accept("{-"):
+			d, err := p.deletion()
+			if err != nil {
+				return nil, err
+			}
+			if !p.eof() {
+				return nil, p.errorf("expected end of transform after '}'")
+			}
+			return append(t, d), nil
+
+		case p.accept("{"):
+			r, err := p.replacement()
+			if err != nil {
+				return nil, err
+			}
+			if !p.eof() {
+				return nil, p.errorf("expected end of transform after '}'")
+			}
+			return append(t, r), nil
+
+		default:
+			return nil, p.errorf("expected '.', '[' or '{'")
+		}
+	}
+	// a transform has to end with an assignment
+	return nil, p.errorf("expected '{' and an assignment")
+}
+
+func (p *parser) replacement() (replacement, error) {
+	var r replacement
+	err := p.nest("=<?}", func() error {
+		var err error
+		if r.to, err = p.destinationPath(); err != nil {
+			return err
+		}
+		for _, op := range []string{"=", "<-", "?="} {
+			if p.accept(op) {
+				r.op = op
+				break
+			}
+		}
+		if r.op == "" {
+			return p.errorf("expected '=', '<-' or '?=' after destination")
+		}
+		start := p.pos
+		if r.from, err = p.sourcePath(); err != nil {
+			return err
+		}
+		if r.op == "<-" {
+			if err := p.checkMove(start, r.from); err != nil {
+				return err
+			}
+		}
+		if !p.accept("}") {
+			return p.errorf("expected '}' after source")
+		}
+		return nil
+	})
+	return r, err
+}
+
+// checkMove makes sure a move's source is something that can be deleted
+// afterwards.
+func (p *parser) checkMove(start int, from path) error {
+	end := p.pos
+	p.pos = start
+	if len(from) == 0 {
+		return p.errorf("expected something to move after '<-'")
+	}
+	switch from[0].(type) {
+	case literal, call, binary, regexpArg:
+		return p.errorf("cannot move %q: it is computed, not somewhere in the object", p.src[start:end])
+	}
+	for _, st := range from {
+		if _, ok := st.(recursive); ok {
+			return p.errorf("cannot move %q: it could be anywhere", p.src[start:end])
+		}
+	}
+	p.pos = end
+	return nil
+}
+
+// deletion parses the path after {-, which may also use [] and .() to
+// delete from every element.
+func (p *parser) deletion() (deletion, error) {
+	var d deletion
+	err := p.nest("}", func() error {
+		for !p.atStop() {
+			switch {
+			case p.accept("[]"):
+				d.at = append(d.at, allIndices{})
+			case p.accept(".()"):
+				d.at = append(d.at, allFields{})
+			default:
+				start := p.pos
+				st, err := p.pathStep()
+				if err != nil {
+					return err
+				}
+				if _, ok := st.(recursive); ok {
+					p.pos = start
+					return p.errorf("cannot delete from anywhere, use [] or .() instead")
+				}
+				d.at = append(d.at, st)
+			}
+		}
+		if len(d.at) == 0 {
+			return p.errorf("expected something to delete after '-'")
+		}
+		if !p.accept("}") {
+			return p.errorf("expected '}' after deletion")
+		}
+		return nil
+	})
+	return d, err
+}
+
+func (pth path) String() string {
+	var s string
+	for _, st := range pth {
+		switch st := st.(type) {
+		case explicitIndex:
+			s += fmt.Sprintf("[%d]", st.index)
+		case explicitField:
+			if isBareName(st.field) {
+				s += "." + st.field
+			} else {
+				s += "." + strconv.Quote(st.field)
+			}
+		case slice:
+			s += "["
+			if st.hasStart {
+				s += strconv.Itoa(st.start)
+			}
+			s += ":"
+			if st.hasEnd {
+				s += strconv.Itoa(st.end)
+			}
+			if st.stride != 1 {
+				s += ":" + strconv.Itoa(st.stride)
+			}
+			s += "]"
+		case recursive:
+			s += ".**"
+		case literal:
+			b, _ := json.Marshal(st.value)
+			s += string(b)
+		case binary:
+			s += "(" + st.String() + ")"
+		case call:
+			s += st.String()
+		case regexpArg:
+			s += "/" + st.re.String() + "/"
+		case allIndices:
+			s += "[]"
+		case allFields:
+			s += ".()"
+		}
+	}
+	return s
+}
@@ -1,20 +1,54 @@
 package main
 
-import (
-	"fmt"
-	"strconv"
-	"strings"
-)
-
-func getExplicitIndex(obj interface{}, from, index string) (interface{}, error) {
-	// log.Printf("gei %q %s", from, index)
-	rfrom := strings.TrimPrefix(from, fmt.Sprintf("[%s]", index))
-	idx, err := strconv.ParseInt(index, 10, 64)
-	if err != nil {
-		panic(fmt.Sprintf("somehow got bad strconv.ParseInt(%q): %v", index, err))
+// getRecursive finds rfrom anywhere inside obj, and returns a list of
+// everything it found.
+func getRecursive(obj interface{}, rfrom path) (interface{}, error) {
+	r := make([]interface{}, 0)
+	root := true
+	descend(obj, func(subobj interface{}) bool {
+		// with nothing after .**, everything inside obj matches, but obj
+		// itself would end up inside of itself
+		if root && len(rfrom) == 0 {
+			root = false
+			return true
+		}
+		root = false
+		if sr, err := getValue(subobj, rfrom); err == nil {
+			r = append(r, sr)
+		}
+		return true
+	})
+	if len(r) == 0 {
+		return nil, errNotFound
 	}
+	return r, nil
+}
+
+// copyValue makes a deep copy of a decoded json value, so that a literal
+// used for many objects doesn't end up shared between them.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		r := make([]interface{}, len(v))
+		for i, sv := range v {
+			r[i] = copyValue(sv)
+		}
+		return r
+	case map[string]interface{}:
+		r := make(map[string]interface{}, len(v))
+		for k, sv := range v {
+			r[k] = copyValue(sv)
+		}
+		return r
+	}
+	return v
+}
+
+func getExplicitIndex(obj interface{}, rfrom path, idx int) (interface{}, error) {
+	// log.Printf("gei %v %d", rfrom, idx)
 	if v, ok := obj.([]interface{}); ok {
-		if int(idx) >= len(v) {
+		idx, ok = resolveIndex(idx, len(v))
+		if !ok {
 			return nil, errNotFound
 		}
 		if sr, err := getValue(v[idx], rfrom); err == nil {
@@ -27,8 +61,22 @@ func getExplicitIndex(obj interface{}, from, index string) (interface{}, error)
 
 }
 
-func getExplicitField(obj interface{}, from, field string) (interface{}, error) {
-	rfrom := strings.TrimPrefix(from, fmt.Sprintf(".%s", field))
+// getSlice returns a new list, with rfrom taken from each element of the
+// slice that has it.
+func getSlice(obj interface{}, rfrom path, s slice) (interface{}, error) {
+	if v, ok := obj.([]interface{}); ok {
+		r := make([]interface{}, 0)
+		for _, idx := range s.indices(len(v)) {
+			if sr, err := getValue(v[idx], rfrom); err == nil {
+				r = append(r, sr)
+			}
+		}
+		return r, nil
+	}
+	return nil, errNotList
+}
+
+func getExplicitField(obj interface{}, rfrom path, field string) (interface{}, error) {
 	if v, ok := obj.(map[string]interface{}); ok {
 		if sv, ok := v[field]; ok {
 			if sr, err := getValue(sv, rfrom); err == nil {
@@ -42,24 +90,24 @@ func getExplicitField(obj interface{}, from, field string) (interface{}, error)
 	return nil, errNotStruct
 }
 
-func setExplicitIndex(obj interface{}, to string, setv interface{}, index string) (interface{}, error) {
-	rto := strings.TrimPrefix(to, fmt.Sprintf("[%s]", index))
-	idx, err := strconv.ParseInt(index, 10, 64)
-	if err != nil {
-		panic(fmt.Sprintf("somehow got bad strconv.ParseInt(%q): %v", index, err))
-	}
-
+func setExplicitIndex(obj interface{}, rto path, setv interface{}, idx int) (interface{}, error) {
 	v, ok := obj.([]interface{})
 	if !ok {
 		return nil, errNotList
 	}
 
+	if idx < 0 {
+		if idx += len(v); idx < 0 {
+			return nil, errNotFound
+		}
+	}
+
 	// build up the list if it's not big enough
-	for int(idx) >= len(v) {
+	for idx >= len(v) {
 		v = append(v, nil)
 	}
 
-	if rto == "" {
+	if len(rto) == 0 {
 		v[idx] = setv
 		return v, nil
 	}
@@ -80,15 +128,14 @@ func setExplicitIndex(obj interface{}, to string, setv interface{}, index string
 	}
 }
 
-func setExplicitField(obj interface{}, to string, setv interface{}, field string) (interface{}, error) {
-	// log.Printf("sef %q %v %q", to, setv, field)
-	rto := strings.TrimPrefix(to, fmt.Sprintf(".%s", field))
+func setExplicitField(obj interface{}, rto path, setv interface{}, field string) (interface{}, error) {
+	// log.Printf("sef %v %v %q", rto, setv, field)
 	v, ok := obj.(map[string]interface{})
 	if !ok {
 		return nil, errNotStruct
 	}
 
-	if rto == "" {
+	if len(rto) == 0 {
 		v[field] = setv
 		return v, nil
 	}
@@ -109,12 +156,107 @@ func setExplicitField(obj interface{}, to string, setv interface{}, field string
 	}
 }
 
-func newFieldObjRto(rto string) (interface{}, error) {
-	if strings.HasPrefix(rto, ".") {
+func newFieldObjRto(rto path) (interface{}, error) {
+	switch rto[0].(type) {
+	case explicitField:
 		return map[string]interface{}{}, nil
-	}
-	if strings.HasPrefix(rto, "[") {
+	case explicitIndex:
 		return make([]interface{}, 0, 1), nil
 	}
 	return nil, errIllegalOp
 }
+
+func deleteExplicitIndex(obj interface{}, rat path, idx int) (interface{}, error) {
+	v, ok := obj.([]interface{})
+	if !ok {
+		return obj, nil
+	}
+	idx, ok = resolveIndex(idx, len(v))
+	if !ok {
+		return v, nil
+	}
+
+	if len(rat) == 0 {
+		return append(v[:idx:idx], v[idx+1:]...), nil
+	}
+
+	if sr, err := deleteValue(v[idx], rat); err != nil {
+		return nil, err
+	} else {
+		v[idx] = sr
+		return v, nil
+	}
+}
+
+func deleteSlice(obj interface{}, rat path, s slice) (interface{}, error) {
+	v, ok := obj.([]interface{})
+	if !ok {
+		return obj, nil
+	}
+
+	if len(rat) == 0 {
+		doomed := map[int]bool{}
+		for _, idx := range s.indices(len(v)) {
+			doomed[idx] = true
+		}
+		r := make([]interface{}, 0, len(v)-len(doomed))
+		for idx, sv := range v {
+			if !doomed[idx] {
+				r = append(r, sv)
+			}
+		}
+		return r, nil
+	}
+
+	for _, idx := range s.indices(len(v)) {
+		if sr, err := deleteValue(v[idx], rat); err != nil {
+			return nil, err
+		} else {
+			v[idx] = sr
+		}
+	}
+	return v, nil
+}
+
+func deleteExplicitField(obj interface{}, rat path, field string) (interface{}, error) {
+	v, ok := obj.(map[string]interface{})
+	if !ok {
+		return obj, nil
+	}
+	sv, ok := v[field]
+	if !ok {
+		return v, nil
+	}
+
+	if len(rat) == 0 {
+		delete(v, field)
+		return v, nil
+	}
+
+	if sr, err := deleteValue(sv, rat); err != nil {
+		return nil, err
+	} else {
+		v[field] = sr
+		return v, nil
+	}
+}
+
+func deleteAllFields(obj interface{}, rat path) (interface{}, error) {
+	v, ok := obj.(map[string]interface{})
+	if !ok {
+		return obj, nil
+	}
+
+	if len(rat) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	for k, sv := range v {
+		if sr, err := deleteValue(sv, rat); err != nil {
+			return nil, err
+		} else {
+			v[k] = sr
+		}
+	}
+	return v, nil
+}
@@ -1,16 +1,13 @@
 package main
 
 import (
-	"fmt"
-	"strconv"
-	"strings"
+	"regexp"
 )
 
-func transformAllIndices(obj interface{}, targ string) (interface{}, error) {
-	rtarg := strings.TrimPrefix(targ, "[]")
+func transformAllIndices(obj interface{}, rt []step) (interface{}, error) {
 	if v, ok := obj.([]interface{}); ok {
 		for i, sv := range v {
-			if sr, err := transform(sv, rtarg); err == nil {
+			if sr, err := transform(sv, rt); err == nil {
 				v[i] = sr
 			} else if err == errUnrecognizedOp {
 				return nil, err
@@ -21,14 +18,13 @@ func transformAllIndices(obj interface{}, targ string) (interface{}, error) {
 	return nil, errNotList
 }
 
-func transformExplicitIndex(obj interface{}, targ, index string) (interface{}, error) {
-	rtarg := strings.TrimPrefix(targ, fmt.Sprintf("[%s]", index))
-	idx, err := strconv.ParseInt(index, 10, 64)
-	if err != nil {
-		panic(fmt.Sprintf("somehow got bad strconv.ParseInt(%q): %v", index, err))
-	}
+func transformExplicitIndex(obj interface{}, rt []step, idx int) (interface{}, error) {
 	if v, ok := obj.([]interface{}); ok {
-		if sr, err := transform(v[idx], rtarg); err == nil {
+		idx, ok = resolveIndex(idx, len(v))
+		if !ok {
+			return nil, errNotFound
+		}
+		if sr, err := transform(v[idx], rt); err == nil {
 			v[idx] = sr
 		} else if err == errUnrecognizedOp {
 			return nil, err
@@ -38,11 +34,41 @@ func transformExplicitIndex(obj interface{}, targ, index string) (interface{}, e
 	return nil, errNotList
 }
 
-func transformAllFields(obj interface{}, targ string) (interface{}, error) {
-	rtarg := strings.TrimPrefix(targ, ".()")
+func transformSlice(obj interface{}, rt []step, s slice) (interface{}, error) {
+	if v, ok := obj.([]interface{}); ok {
+		for _, i := range s.indices(len(v)) {
+			if sr, err := transform(v[i], rt); err == nil {
+				v[i] = sr
+			} else if err == errUnrecognizedOp {
+				return nil, err
+			}
+		}
+		return v, nil
+	}
+	return nil, errNotList
+}
+
+func transformAllFields(obj interface{}, rt []step) (interface{}, error) {
 	if v, ok := obj.(map[string]interface{}); ok {
 		for k, sv := range v {
-			if sr, err := transform(sv, rtarg); err == nil {
+			if sr, err := transform(sv, rt); err == nil {
+				v[k] = sr
+			} else if err == errUnrecognizedOp {
+				return nil, err
+			}
+		}
+		return v, nil
+	}
+	return nil, errNotStruct
+}
+
+func transformFieldPattern(obj interface{}, rt []step, re *regexp.Regexp) (interface{}, error) {
+	if v, ok := obj.(map[string]interface{}); ok {
+		for k, sv := range v {
+			if !re.MatchString(k) {
+				continue
+			}
+			if sr, err := transform(sv, rt); err == nil {
 				v[k] = sr
 			} else if err == errUnrecognizedOp {
 				return nil, err
@@ -53,10 +79,9 @@ func transformAllFields(obj interface{}, targ string) (interface{}, error) {
 	return nil, errNotStruct
 }
 
-func transformExplicitField(obj interface{}, targ, field string) (interface{}, error) {
-	rtarg := strings.TrimPrefix(targ, fmt.Sprintf(".%s", field))
+func transformExplicitField(obj interface{}, rt []step, field string) (interface{}, error) {
 	if v, ok := obj.(map[string]interface{}); ok {
-		if sr, err := transform(v[field], rtarg); err == nil {
+		if sr, err := transform(v[field], rt); err == nil {
 			v[field] = sr
 		} else if err == errUnrecognizedOp {
 			return nil, err
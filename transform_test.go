@@ -42,6 +42,377 @@ func TestRename(t *testing.T) {
 	})
 }
 
+// TestLiterals demonstrates how to put new values into an object.
+func TestLiterals(t *testing.T) {
+	// the source can be any json value instead of a path
+	testCase(t, tc{
+		name:         "strings and numbers",
+		input:        `{}`,
+		args:         []string{`t:{.env="prod"}`, "t:{.replicas=3}", "t:{.ready=false}"},
+		expectedJSON: `{"env":"prod","ready":false,"replicas":3}`,
+	})
+	testCase(t, tc{
+		name:         "lists and structures",
+		input:        `{}`,
+		args:         []string{"t:{.tags=[]}", `t:{.meta={"a":1,"b":[2]}}`},
+		expectedJSON: `{"meta":{"a":1,"b":[2]},"tags":[]}`,
+	})
+	// though [<index>] is still a path
+	testCase(t, tc{
+		name:         "index, not a list",
+		input:        `[1,2]`,
+		args:         []string{"t:{[2]=[0]}"},
+		expectedJSON: `[1,2,1]`,
+	})
+	// every object gets its own copy
+	testCase(t, tc{
+		name: "literal for many objects",
+		input: `
+			{"x":1}
+			{"x":2}
+			`,
+		args: []string{`t:{.l=["x"]}`, "t:{.l[1]=.x}"},
+		expectedOutput: `
+			{
+			  "l": [
+			    "x",
+			    1
+			  ],
+			  "x": 1
+			}
+			{
+			  "l": [
+			    "x",
+			    2
+			  ],
+			  "x": 2
+			}
+			`,
+	})
+}
+
+// TestDefaults demonstrates how to fill in values only where they are missing.
+func TestDefaults(t *testing.T) {
+	// {<destination>?=<source>} leaves the destination alone if it's already there
+	testCase(t, tc{
+		name: "default zone",
+		input: `
+			{"zone":"us-east1-b","region":"us-east1"}
+			{"region":"us-west1"}
+			`,
+		args: []string{"t:{.zone?=.region}", `t:{.owner?="unknown"}`, "f:@zone,owner"},
+		expectedOutput: `
+			{
+			  "owner": "unknown",
+			  "zone": "us-east1-b"
+			}
+			{
+			  "owner": "unknown",
+			  "zone": "us-west1"
+			}
+			`,
+	})
+	// and if the source isn't there either, nothing is filled in
+	testCase(t, tc{
+		name:         "no default",
+		input:        `{}`,
+		args:         []string{"t:{.zone?=.region}"},
+		expectedJSON: `{}`,
+	})
+	// that goes for indices, too
+	testCase(t, tc{
+		name:         "default index",
+		input:        `[1]`,
+		args:         []string{"t:{[0]?=0}", "t:{[2]?=0}"},
+		expectedJSON: `[1,null,0]`,
+	})
+}
+
+// TestArithmetic demonstrates how to compute new numbers.
+func TestArithmetic(t *testing.T) {
+	// sources can be added, subtracted, multiplied, divided and taken modulo,
+	// with parentheses where the usual order isn't what you want
+	testCase(t, tc{
+		name:         "megabytes to gigabytes",
+		input:        `{"memMB":2048}`,
+		args:         []string{"t:{.memGB=.memMB/1024}"},
+		expectedJSON: `{"memGB":2,"memMB":2048}`,
+	})
+	testCase(t, tc{
+		name:         "totals",
+		input:        `{"a":1,"b":2,"c":3}`,
+		args:         []string{"t:{.total=.a+.b*.c}", "t:{.other=(.a + .b) * .c % 4}"},
+		expectedJSON: `{"a":1,"b":2,"c":3,"other":1,"total":7}`,
+	})
+	// since - is allowed in field names, put a space before it to subtract a
+	// number from a field
+	testCase(t, tc{
+		name:         "subtraction",
+		input:        `{"a":5,"b":2}`,
+		args:         []string{"t:{.c=.a-.b}", "t:{.d=.a -1}"},
+		expectedJSON: `{"a":5,"b":2,"c":3,"d":4}`,
+	})
+	// otherwise the - is part of the field name
+	testCase(t, tc{
+		name:          "field with a -",
+		input:         `{"a":5}`,
+		args:          []string{"t:{.t=.a-1}"},
+		expectedError: `"\.a-1" not found \(put spaces around '-' to subtract\)`,
+	})
+	// only numbers can be used
+	testCase(t, tc{
+		name:          "not a number",
+		input:         `{"a":1,"s":"x"}`,
+		args:          []string{"t:{.b=.a+.s}"},
+		expectedError: `cannot compute "\.a\+\.s": "x" is not a number`,
+	})
+}
+
+// TestStrings demonstrates functions for reshaping strings.
+func TestStrings(t *testing.T) {
+	// call a function with <name>(<source>,<source>,...)
+	testCase(t, tc{
+		name:         "case",
+		input:        `{"name":"Worker-1"}`,
+		args:         []string{"t:{.lower=lower(.name)}", "t:{.upper=upper(.name)}"},
+		expectedJSON: `{"lower":"worker-1","name":"Worker-1","upper":"WORKER-1"}`,
+	})
+	// and calls can be nested, so zone URLs can be cut down to their names
+	testCase(t, tc{
+		name:         "last part of a url",
+		input:        `{"zone":"https://compute/zones/us-east1-b"}`,
+		args:         []string{`t:{.zone=last(split(.zone,"/"))}`},
+		expectedJSON: `{"zone":"us-east1-b"}`,
+	})
+	testCase(t, tc{
+		name:         "trim, replace and substr",
+		input:        `{"s":"  owned-by-jasmuth "}`,
+		args:         []string{`t:{.s=replace(trim(.s),"owned-by-","")}`, "t:{.initial=substr(.s,0,1)}"},
+		expectedJSON: `{"initial":"j","s":"jasmuth"}`,
+	})
+	// a length past the end stops at the end
+	testCase(t, tc{
+		name:         "long substr",
+		input:        `{"s":"hello"}`,
+		args:         []string{"t:{.x=substr(.s,1,1e30)}", "t:{.y=substr(.s,1e30)}"},
+		expectedJSON: `{"s":"hello","x":"ello","y":""}`,
+	})
+	testCase(t, tc{
+		name:         "join",
+		input:        `{"tags":["a","b",3]}`,
+		args:         []string{`t:{.tags=join(.tags,", ")}`},
+		expectedJSON: `{"tags":"a, b, 3"}`,
+	})
+	// a path can carry on from what a function returns
+	testCase(t, tc{
+		name:         "index a split",
+		input:        `{"name":"a.b.c"}`,
+		args:         []string{`t:{.middle=split(.name,".")[1]}`},
+		expectedJSON: `{"middle":"b","name":"a.b.c"}`,
+	})
+	testCase(t, tc{
+		name:          "not a string",
+		input:         `{"n":3}`,
+		args:          []string{"t:{.n=upper(.n)}"},
+		expectedError: `cannot compute "upper\(\.n\)": 3 is not a string`,
+	})
+}
+
+// TestRegexp demonstrates pulling apart strings with regular expressions.
+func TestRegexp(t *testing.T) {
+	// match(<string>,/<regexp>/,<group>) extracts a capture group
+	testCase(t, tc{
+		name:         "owner from who",
+		input:        `{"who":"owned-by-jasmuth"}`,
+		args:         []string{"t:{.owner=match(.who,/owned-by-(.*)/,1)}"},
+		expectedJSON: `{"owner":"jasmuth","who":"owned-by-jasmuth"}`,
+	})
+	// and without a match, you get null
+	testCase(t, tc{
+		name:         "no owner",
+		input:        `{"who":"someone"}`,
+		args:         []string{"t:{.owner=match(.who,/owned-by-(.*)/,1)}"},
+		expectedJSON: `{"owner":null,"who":"someone"}`,
+	})
+	// sub(<string>,/<regexp>/,<replacement>) substitutes every match
+	testCase(t, tc{
+		name:         "strip prefix",
+		input:        `{"who":"owned-by-jasmuth"}`,
+		args:         []string{`t:{.who=sub(.who,/owned-by-/,"")}`},
+		expectedJSON: `{"who":"jasmuth"}`,
+	})
+	testCase(t, tc{
+		name:         "swap with groups",
+		input:        `{"name":"worker-7"}`,
+		args:         []string{`t:{.name=sub(.name,/(\w+)-(\d+)/,"$2-$1")}`},
+		expectedJSON: `{"name":"7-worker"}`,
+	})
+	// the regexp can also come from the object
+	before := len(regexps)
+	testCase(t, tc{
+		name: "regexp from the object",
+		input: `
+			{"s":"a1","pattern":"[0-9]"}
+			{"s":"b2","pattern":"[a-z]"}
+			`,
+		args: []string{"t:{.m=match(.s,.pattern)}", "f:@m"},
+		expectedOutput: `
+			{
+			  "m": "1"
+			}
+			{
+			  "m": "b"
+			}
+			`,
+	})
+	// but since there could be one for every object, they aren't kept
+	if len(regexps) != before {
+		t.Errorf("regexps from the object were cached")
+	}
+}
+
+// TestLength demonstrates counting what's in a value.
+func TestLength(t *testing.T) {
+	// len(<source>) counts the elements of a list, the fields of an object,
+	// or the characters of a string
+	testCase(t, tc{
+		name:         "lengths",
+		input:        `{"l":[1,2,3],"o":{"a":1},"s":"héllo"}`,
+		args:         []string{"t:{.n=len(.l)+len(.o)+len(.s)}", "f:@n"},
+		expectedJSON: `{"n":9}`,
+	})
+	testCase(t, tc{
+		name:          "no length",
+		input:         `{"x":3}`,
+		args:          []string{"t:{.n=len(.x)}"},
+		expectedError: `3 has no length`,
+	})
+}
+
+// TestConversions demonstrates converting values between types.
+func TestConversions(t *testing.T) {
+	testCase(t, tc{
+		name:  "convert",
+		input: `{"size":"100","count":3,"flag":"true"}`,
+		args: []string{
+			"t:{.size=tonumber(.size)}",
+			"t:{.count=tostring(.count)}",
+			"t:{.flag=tobool(.flag)}",
+			"t:{.kind=type(.size)}",
+		},
+		expectedJSON: `{"count":"3","flag":true,"kind":"number","size":100}`,
+	})
+	testCase(t, tc{
+		name:          "not convertible",
+		input:         `{"size":"big"}`,
+		args:          []string{"t:{.size=tonumber(.size)}"},
+		expectedError: `"big" is not a number`,
+	})
+	testCase(t, tc{
+		name:          "not a json number",
+		input:         `{"size":"infinity"}`,
+		args:          []string{"t:{.size=tonumber(.size)}"},
+		expectedError: `"infinity" is not a number`,
+	})
+}
+
+// TestDelete demonstrates how to remove parts of an object.
+func TestDelete(t *testing.T) {
+	// to remove a field or an index, use {-<path>}
+	testCase(t, tc{
+		name:         "delete a field",
+		input:        `{"metadata":{"name":"x","managedFields":[1,2]}}`,
+		args:         []string{"t:{-.metadata.managedFields}"},
+		expectedJSON: `{"metadata":{"name":"x"}}`,
+	})
+	testCase(t, tc{
+		name:         "delete an index",
+		input:        `[1,2,3,4]`,
+		args:         []string{"t:{-[-1]}", "t:{-[0]}"},
+		expectedJSON: `[2,3]`,
+	})
+	// the path can use [] and .() to delete from every element
+	testCase(t, tc{
+		name:         "delete from every element",
+		input:        `{"items":[{"a":1,"b":2},{"a":3,"b":4}]}`,
+		args:         []string{"t:{-.items[].b}"},
+		expectedJSON: `{"items":[{"a":1},{"a":3}]}`,
+	})
+	testCase(t, tc{
+		name:         "delete from every field",
+		input:        `{"x":{"a":1,"b":2},"y":{"a":3}}`,
+		args:         []string{"t:{-.().a}"},
+		expectedJSON: `{"x":{"b":2},"y":{}}`,
+	})
+	// and the delete can come after other transform steps, too
+	testCase(t, tc{
+		name:         "nested delete",
+		input:        `[{"a":1,"b":2},{"a":3,"b":4}]`,
+		args:         []string{"t:[]{-.a}"},
+		expectedJSON: `[{"b":2},{"b":4}]`,
+	})
+	// deleting something that isn't there does nothing
+	testCase(t, tc{
+		name:         "delete a missing field",
+		input:        `{"a":1}`,
+		args:         []string{"t:{-.b.c}"},
+		expectedJSON: `{"a":1}`,
+	})
+}
+
+// TestMove demonstrates how to move part of an object, rather than copy it.
+func TestMove(t *testing.T) {
+	// use {<destination><-<source>} to remove the source as it is copied
+	testCase(t, tc{
+		name:         "rename a field",
+		input:        `{"oldName":"x","other":1}`,
+		args:         []string{"t:{.newName<-.oldName}"},
+		expectedJSON: `{"newName":"x","other":1}`,
+	})
+	// the destination is created just like a copy's would be
+	testCase(t, tc{
+		name:         "move deeper",
+		input:        `{"a":{"b":[1,2,3]}}`,
+		args:         []string{"t:{.c.d[1]<-.a.b[-1]}"},
+		expectedJSON: `{"a":{"b":[1,2]},"c":{"d":[null,3]}}`,
+	})
+	// the source is removed first, so moving within a list shifts what's after it
+	testCase(t, tc{
+		name:         "move within a list",
+		input:        `["a","b","c"]`,
+		args:         []string{"t:{[0]<-[2]}"},
+		expectedJSON: `["c","b"]`,
+	})
+	// if the source isn't there, nothing moves
+	testCase(t, tc{
+		name:          "move a missing field",
+		input:         `{"a":1}`,
+		args:          []string{"t:{.b<-.c}"},
+		expectedError: `".c" not found`,
+	})
+	// if the destination can't be set, the source stays where it was
+	testCase(t, tc{
+		name:         "failed move",
+		input:        `[{"a":1,"c":"keep me"}]`,
+		args:         []string{"t:[]{.a.b<-.c}"},
+		expectedJSON: `[{"a":1,"c":"keep me"}]`,
+	})
+	// and only things in the object can be moved, which is checked before
+	// reading any input
+	testCase(t, tc{
+		name:          "move a literal",
+		input:         `{"a":1}`,
+		args:          []string{"t:{.a<-1}"},
+		expectedError: `cannot move "1": it is computed, not somewhere in the object at offset 7`,
+	})
+	testCase(t, tc{
+		name:          "move a function",
+		input:         `{"b":"x"}`,
+		args:          []string{"t:{.a<-upper(.b)}"},
+		expectedError: `cannot move "upper\(\.b\)": it is computed`,
+	})
+}
+
 // TestDeepTransform demonstrates how to do transforms deep inside objects,
 // potentially with the source value and destination value not being
 // in the same place.
@@ -69,6 +440,14 @@ func TestDeepTransforms(t *testing.T) {
 		expectedJSON: `{"x":[1,3,3], "y":[4,6,6]}`,
 	})
 
+	// .(<glob>) and .(/<regexp>/) only transform the fields that match.
+	testCase(t, tc{
+		name:         "pattern field transform",
+		input:        `{"env_a":{"x":1},"env_b":{"x":2},"other":{"x":3}}`,
+		args:         []string{"t:.(env_*){.y=.x}"},
+		expectedJSON: `{"env_a":{"x":1,"y":1},"env_b":{"x":2,"y":2},"other":{"x":3}}`,
+	})
+
 	// you can dig in farther with the right hand side of the assignment.
 	testCase(t, tc{
 		name:         "transform with a deeper source",
@@ -97,6 +476,60 @@ func TestDeepTransforms(t *testing.T) {
 		expectedError: "not a list",
 	})
 
+	// fields with unusual names can be quoted on either side.
+	testCase(t, tc{
+		name:         "quoted fields",
+		input:        `{"a.b":{"c d":1}}`,
+		args:         []string{`t:{.["e-f"]."g h"=."a.b".["c d"]}`},
+		expectedJSON: `{"a.b":{"c d":1},"e-f":{"g h":1}}`,
+	})
+
+	// negative indices and slices work for sources, and the destination can
+	// count back from the end of a list as well.
+	testCase(t, tc{
+		name:         "latest entry",
+		input:        `{"log":["a","b","c"]}`,
+		args:         []string{"t:{.latest=.log[-1]}", "t:{.first=.log[:2]}"},
+		expectedJSON: `{"first":["a","b"],"latest":"c","log":["a","b","c"]}`,
+	})
+	testCase(t, tc{
+		name:         "transform a slice",
+		input:        `[{"x":1},{"x":2},{"x":3}]`,
+		args:         []string{"t:[1:]{.y=.x}", "t:{[-1].x=[0].x}"},
+		expectedJSON: `[{"x":1},{"x":2,"y":2},{"x":1,"y":3}]`,
+	})
+
+	// a source found with ..<field> could be in many places, so you get a
+	// list of all of them.
+	testCase(t, tc{
+		name:         "recursive source",
+		input:        `{"a":{"key":1},"b":[{"key":2},{"other":3}]}`,
+		args:         []string{"t:{.keys=..key}"},
+		expectedJSON: `{"a":{"key":1},"b":[{"key":2},{"other":3}],"keys":[1,2]}`,
+	})
+	// and .** on its own is everything inside the object, but not the
+	// object itself
+	testCase(t, tc{
+		name:         "everything",
+		input:        `{"a":{"b":1}}`,
+		args:         []string{"t:{.all=.**}", "f:..b"},
+		expectedJSON: `{"a":{"b":1},"all":[{"b":1},1]}`,
+	})
+	// .** does the same for whatever path comes after it
+	testCase(t, tc{
+		name:         "recursive source path",
+		input:        `{"a":{"meta":{"name":"x"}},"b":[{"meta":{"name":"y"}}]}`,
+		args:         []string{"t:{.names=.**.meta.name}", "f:@names"},
+		expectedJSON: `{"names":["x","y"]}`,
+	})
+	// but you can't send something to every place a field might be.
+	testCase(t, tc{
+		name:          "no recursive destination",
+		input:         `{"a":{"key":1}}`,
+		args:          []string{"t:{..key=.a}"},
+		expectedError: `cannot use "\.\.key" as destination`,
+	})
+
 	// when you dig inside the { and }, it must be explicit.
 	testCase(t, tc{
 		name:          "no non-explicit indices",
@@ -110,4 +543,11 @@ func TestDeepTransforms(t *testing.T) {
 		args:          []string{"t:{.y=.()[1]}"},
 		expectedError: `cannot use "\.\(\)\[1\]" as source`,
 	})
+	// a copy is separate from what it was copied from
+	testCase(t, tc{
+		name:         "separate copy",
+		input:        `{"a":{"x":1,"y":2}}`,
+		args:         []string{"t:{.b=.a}", "t:{-.a.x}", "t:{.a.y=5}"},
+		expectedJSON: `{"a":{"y":5},"b":{"x":1,"y":2}}`,
+	})
 }